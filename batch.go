@@ -0,0 +1,101 @@
+package fstore
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// LineError is the error for a single line of a batch.
+type LineError struct {
+	Line int // 1-based line number
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// BatchReport summarizes a StoreBatch call.
+type BatchReport struct {
+	Lines  int // non-empty lines read
+	Stored int // lines stored successfully
+	Errors []*LineError
+}
+
+// Database returns the dictionary of the listener.
+func (s *StoreListener) Database() *Database {
+	return &s.database
+}
+
+// SetDatabase replaces the dictionary of the listener, e.g. with one read by
+// ReadDatabase.
+func (s *StoreListener) SetDatabase(d Database) {
+	s.database = d
+	// plans cache key ids of the old dictionary
+	s.resetPlans()
+}
+
+// StoreBatch reads newline-delimited JSON from r, compacts every line into
+// the shared dictionary and writes the results to records, one per line.
+// Object keys keep their input order, see StoreJSON.
+// Lines that cannot be stored are reported in the BatchReport and written
+// as null, so output lines keep matching input lines. Once all lines are
+// stored, the dictionary is written to dict, if it is not nil.
+//
+// Only I/O errors abort the batch.
+func (s *StoreListener) StoreBatch(r io.Reader, records io.Writer, dict io.Writer) (BatchReport, error) {
+	var report BatchReport
+	in := bufio.NewReader(r)
+	out := bufio.NewWriter(records)
+
+	for line := 1; ; line++ {
+		b, err := in.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return report, err
+		}
+		if len(bytes.TrimSpace(b)) > 0 {
+			report.Lines++
+			res, lineErr := s.storeLine(b)
+			if lineErr != nil {
+				report.Errors = append(report.Errors, &LineError{Line: line, Err: lineErr})
+				res = []byte("null")
+			} else {
+				report.Stored++
+			}
+			if _, werr := out.Write(append(res, '\n')); werr != nil {
+				return report, werr
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+	}
+
+	if err := out.Flush(); err != nil {
+		return report, err
+	}
+	if dict != nil {
+		if _, err := s.database.WriteTo(dict); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// storeLine stores a single JSON document and returns the compacted result
+// as JSON. Keys keep their order, see StoreJSON.
+func (s *StoreListener) storeLine(b []byte) ([]byte, error) {
+	res, err := s.StoreJSON(b)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(res)
+}
@@ -0,0 +1,148 @@
+package fstore
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStoreBatch(t *testing.T) {
+	in := `{"ua":"Mozilla/5.0","platform":"macOS"}
+not json
+
+{"ua":"Mozilla/5.0","platform":"Windows"}
+["arrays","are","not","stored"]
+`
+	f := Listener()
+	f.Threshhold = 5
+	f.UseKeyCompression = true
+
+	var records, dict bytes.Buffer
+	report, err := f.StoreBatch(strings.NewReader(in), &records, &dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Lines != 4 || report.Stored != 2 || len(report.Errors) != 2 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if report.Errors[0].Line != 2 || report.Errors[1].Line != 5 {
+		t.Errorf("unexpected error lines: %v, %v", report.Errors[0], report.Errors[1])
+	}
+
+	db, err := ReadDatabase(&dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restorer := Listener()
+	restorer.UseKeyCompression = true
+	restorer.SetDatabase(db)
+
+	var got []any
+	sc := bufio.NewScanner(&records)
+	for sc.Scan() {
+		var rec any
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatal(err)
+		}
+		res, err := restorer.Restore(rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, res)
+	}
+	want := []any{
+		map[string]any{"ua": "Mozilla/5.0", "platform": "macOS"},
+		nil,
+		map[string]any{"ua": "Mozilla/5.0", "platform": "Windows"},
+		nil,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestStoreBatchParallel(t *testing.T) {
+	var lines bytes.Buffer
+	for i := 0; i < 20; i++ {
+		var data map[string]any
+		if err := json.Unmarshal(fp2, &data); err != nil {
+			t.Fatal(err)
+		}
+		data["id"] = fmt.Sprintf("record-%d", i)
+		b, err := json.Marshal(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines.Write(append(b, '\n'))
+		if i == 7 {
+			lines.WriteString("{broken\n")
+		}
+	}
+
+	var stats Stats
+	run := func() (string, string, BatchReport) {
+		f := Listener()
+		f.Threshhold = 5
+		f.UseKeyCompression = true
+		f.CollectStats = true
+		var records, dict bytes.Buffer
+		report, err := f.StoreBatchParallel(bytes.NewReader(lines.Bytes()), &records, &dict, 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stats = f.Stats()
+		return records.String(), dict.String(), report
+	}
+
+	records, dict, report := run()
+
+	serial := Listener()
+	serial.Threshhold = 5
+	serial.UseKeyCompression = true
+	serial.CollectStats = true
+	var serialRecords, serialDict bytes.Buffer
+	if _, err := serial.StoreBatch(bytes.NewReader(lines.Bytes()), &serialRecords, &serialDict); err != nil {
+		t.Fatal(err)
+	}
+	if serialRecords.String() != records || serialDict.String() != dict {
+		t.Error("parallel and serial batches of the same input differ")
+	}
+	if stats.Calls != 20 || stats != serial.Stats() {
+		t.Errorf("parallel stats %+v differ from serial stats %+v", stats, serial.Stats())
+	}
+
+	if report.Lines != 21 || report.Stored != 20 || len(report.Errors) != 1 || report.Errors[0].Line != 9 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	for i := 0; i < 3; i++ {
+		again, againDict, _ := run()
+		if again != records || againDict != dict {
+			t.Fatal("parallel batches of the same input differ")
+		}
+	}
+
+	db, err := ReadDatabase(strings.NewReader(dict))
+	if err != nil {
+		t.Fatal(err)
+	}
+	restorer := Listener()
+	restorer.UseKeyCompression = true
+	restorer.SetDatabase(db)
+
+	out := strings.Split(strings.TrimSpace(records), "\n")
+	var rec any
+	if err := json.Unmarshal([]byte(out[9]), &rec); err != nil {
+		t.Fatal(err)
+	}
+	res, err := restorer.Restore(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := res.(map[string]any)["id"]; id != "record-8" {
+		t.Errorf("output is out of order, got %v at line 10", id)
+	}
+}
@@ -0,0 +1,185 @@
+package fstore
+
+import (
+	"math/bits"
+	"sort"
+)
+
+// Bitmap is a compressed set of uint32, split like a roaring bitmap into
+// containers of 2^16 values. Sparse containers are sorted arrays, dense
+// ones are bitsets.
+type Bitmap struct {
+	keys       []uint16 // high 16 bits, sorted
+	containers []container
+}
+
+// arrayMax is the size at which an array container becomes a bitset.
+const arrayMax = 4096
+
+type container struct {
+	array  []uint16 // sorted, if bitset is nil
+	bitset []uint64 // 1024 words
+	n      int      // cardinality
+}
+
+func NewBitmap() *Bitmap {
+	return &Bitmap{}
+}
+
+func (b *Bitmap) find(key uint16) (int, bool) {
+	i := sort.Search(len(b.keys), func(i int) bool { return b.keys[i] >= key })
+	return i, i < len(b.keys) && b.keys[i] == key
+}
+
+// Add adds v to the set.
+func (b *Bitmap) Add(v uint32) {
+	key, low := uint16(v>>16), uint16(v)
+	i, ok := b.find(key)
+	if !ok {
+		b.keys = append(b.keys, 0)
+		copy(b.keys[i+1:], b.keys[i:])
+		b.keys[i] = key
+		b.containers = append(b.containers, container{})
+		copy(b.containers[i+1:], b.containers[i:])
+		b.containers[i] = container{}
+	}
+	b.containers[i].add(low)
+}
+
+// Remove removes v from the set.
+func (b *Bitmap) Remove(v uint32) {
+	i, ok := b.find(uint16(v >> 16))
+	if !ok {
+		return
+	}
+	c := &b.containers[i]
+	c.remove(uint16(v))
+	if c.n == 0 {
+		b.keys = append(b.keys[:i], b.keys[i+1:]...)
+		b.containers = append(b.containers[:i], b.containers[i+1:]...)
+	}
+}
+
+// Contains reports whether v is in the set.
+func (b *Bitmap) Contains(v uint32) bool {
+	i, ok := b.find(uint16(v >> 16))
+	return ok && b.containers[i].contains(uint16(v))
+}
+
+// Len returns the number of values in the set.
+func (b *Bitmap) Len() int {
+	n := 0
+	for _, c := range b.containers {
+		n += c.n
+	}
+	return n
+}
+
+// ToSlice returns the values in ascending order.
+func (b *Bitmap) ToSlice() []uint32 {
+	res := make([]uint32, 0, b.Len())
+	for i, c := range b.containers {
+		high := uint32(b.keys[i]) << 16
+		c.each(func(low uint16) {
+			res = append(res, high|uint32(low))
+		})
+	}
+	return res
+}
+
+// And returns the intersection of b and o.
+func (b *Bitmap) And(o *Bitmap) *Bitmap {
+	res := NewBitmap()
+	for i, key := range b.keys {
+		j, ok := o.find(key)
+		if !ok {
+			continue
+		}
+		high := uint32(key) << 16
+		other := &o.containers[j]
+		b.containers[i].each(func(low uint16) {
+			if other.contains(low) {
+				res.Add(high | uint32(low))
+			}
+		})
+	}
+	return res
+}
+
+// Or returns the union of b and o.
+func (b *Bitmap) Or(o *Bitmap) *Bitmap {
+	res := NewBitmap()
+	for _, bm := range []*Bitmap{b, o} {
+		for _, v := range bm.ToSlice() {
+			res.Add(v)
+		}
+	}
+	return res
+}
+
+func (c *container) add(v uint16) {
+	if c.bitset != nil {
+		if c.bitset[v/64]&(1<<(v%64)) == 0 {
+			c.bitset[v/64] |= 1 << (v % 64)
+			c.n++
+		}
+		return
+	}
+
+	i := sort.Search(len(c.array), func(i int) bool { return c.array[i] >= v })
+	if i < len(c.array) && c.array[i] == v {
+		return
+	}
+	c.array = append(c.array, 0)
+	copy(c.array[i+1:], c.array[i:])
+	c.array[i] = v
+	c.n++
+
+	if c.n > arrayMax {
+		c.bitset = make([]uint64, 1024)
+		for _, x := range c.array {
+			c.bitset[x/64] |= 1 << (x % 64)
+		}
+		c.array = nil
+	}
+}
+
+func (c *container) remove(v uint16) {
+	if c.bitset != nil {
+		if c.bitset[v/64]&(1<<(v%64)) != 0 {
+			c.bitset[v/64] &^= 1 << (v % 64)
+			c.n--
+		}
+		return
+	}
+
+	i := sort.Search(len(c.array), func(i int) bool { return c.array[i] >= v })
+	if i < len(c.array) && c.array[i] == v {
+		c.array = append(c.array[:i], c.array[i+1:]...)
+		c.n--
+	}
+}
+
+func (c *container) contains(v uint16) bool {
+	if c.bitset != nil {
+		return c.bitset[v/64]&(1<<(v%64)) != 0
+	}
+	i := sort.Search(len(c.array), func(i int) bool { return c.array[i] >= v })
+	return i < len(c.array) && c.array[i] == v
+}
+
+func (c *container) each(fn func(uint16)) {
+	if c.bitset == nil {
+		for _, v := range c.array {
+			fn(v)
+		}
+		return
+	}
+	for i, w := range c.bitset {
+		for w != 0 {
+			t := bits.TrailingZeros64(w)
+			fn(uint16(i*64 + t))
+			w &= w - 1
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package fstore
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBitmap(t *testing.T) {
+	a, b := NewBitmap(), NewBitmap()
+	want := map[uint32]bool{}
+	for i := uint32(0); i < 10000; i += 2 {
+		a.Add(i)
+		want[i] = true
+	}
+	a.Add(1 << 20)
+	a.Add(1 << 20)
+	for i := uint32(0); i < 10000; i += 3 {
+		b.Add(i)
+	}
+
+	if a.Len() != 5001 || !a.Contains(1<<20) || a.Contains(3) {
+		t.Fatalf("unexpected bitmap: len %d", a.Len())
+	}
+	a.Remove(1 << 20)
+	a.Remove(4)
+	if a.Len() != 4999 || a.Contains(4) {
+		t.Fatalf("unexpected bitmap after remove: len %d", a.Len())
+	}
+
+	and := a.And(b).ToSlice()
+	if len(and) != 1667 || and[0] != 0 || and[1] != 6 {
+		t.Errorf("unexpected intersection: %d values, starting %v", len(and), and[:2])
+	}
+	or := NewBitmap()
+	or.Add(5)
+	or = or.Or(NewBitmap())
+	if !reflect.DeepEqual(or.ToSlice(), []uint32{5}) {
+		t.Errorf("unexpected union: %v", or.ToSlice())
+	}
+}
@@ -0,0 +1,228 @@
+package fstore
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"sort"
+	"strings"
+)
+
+// ClusterOptions configures PutClustered. Zero values use the defaults.
+type ClusterOptions struct {
+	// Group returns the group of a record, e.g. its user-agent family.
+	// Records are only compared with prototypes of their group. By default
+	// records are grouped by their set of top-level keys.
+	Group func(data any) string
+	// MaxDistance is the number of differing values up to which a record
+	// is stored as a delta to a prototype. Records further away from all
+	// prototypes become new prototypes. Default 64.
+	MaxDistance int
+	// PromoteEvery is the number of deltas after which a cluster checks
+	// whether one of its recent members would make a better prototype.
+	// Default 100.
+	PromoteEvery int
+}
+
+const (
+	defaultMaxDistance  = 64
+	defaultPromoteEvery = 100
+)
+
+func (o ClusterOptions) maxDistance() int {
+	if o.MaxDistance > 0 {
+		return o.MaxDistance
+	}
+	return defaultMaxDistance
+}
+
+func (o ClusterOptions) promoteEvery() int {
+	if o.PromoteEvery > 0 {
+		return o.PromoteEvery
+	}
+	return defaultPromoteEvery
+}
+
+// cluster is a prototype record and the deltas stored against it.
+type cluster struct {
+	prototype RecordID
+	leaves    map[string]any
+	members   int
+	// recent members, candidates for a new prototype
+	recent       []RecordID
+	recentLeaves []map[string]any
+}
+
+// PutClustered stores data as a delta to the closest prototype of its group,
+// see ClusterOptions. If no prototype is close enough, data is stored as a
+// full record and becomes a prototype itself.
+func (s *StoreListener) PutClustered(data any) (RecordID, error) {
+	before := s.database.counters
+	// compacted against a private dictionary first, only the record that is
+	// kept, full or delta, goes through the shared one
+	w := s.worker()
+	res, err := w.store(data)
+	if err != nil {
+		return 0, err
+	}
+	probe, err := s.lookup(w, res)
+	if err != nil {
+		return 0, err
+	}
+	leaves := s.leaves(probe)
+
+	group := shapeGroup(data)
+	if s.Clustering.Group != nil {
+		group = s.Clustering.Group(data)
+	}
+
+	var best *cluster
+	bestDist := 0
+	for _, c := range s.clusters[group] {
+		if d := distance(leaves, c.leaves); best == nil || d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+
+	if best == nil || bestDist > s.Clustering.maxDistance() {
+		full, err := s.Store(data)
+		if err != nil {
+			return 0, err
+		}
+		id, err := s.addRecord(full)
+		if err != nil {
+			return 0, err
+		}
+		s.clusters[group] = append(s.clusters[group], &cluster{prototype: id, leaves: s.leaves(full)})
+		s.log(slog.LevelDebug, "new prototype", "group", group, "record", id)
+		return id, nil
+	}
+
+	target, err := w.Restore(res)
+	if err != nil {
+		return 0, err
+	}
+	d, err := s.deltaTo(best.prototype, target)
+	if err != nil {
+		return 0, err
+	}
+	if s.CollectStats {
+		s.collect(data, d, before)
+	}
+	id, err := s.addRecord(d)
+	if err != nil {
+		return 0, err
+	}
+	// the patch is in the dictionary now, so are all values of the record
+	full, err := s.compactedFull(d)
+	if err != nil {
+		return 0, err
+	}
+	best.members++
+	best.recent = append(best.recent, id)
+	best.recentLeaves = append(best.recentLeaves, s.leaves(full))
+	if best.members%s.Clustering.promoteEvery() == 0 {
+		if err := s.promote(group, best); err != nil {
+			return 0, err
+		}
+	}
+	return id, nil
+}
+
+// promote makes the recent member of c closest to all other recent members
+// a new prototype, if it represents them clearly better than the current
+// prototype. Its delta is replaced with the full record.
+func (s *StoreListener) promote(group string, c *cluster) error {
+	defer func() {
+		c.recent, c.recentLeaves = nil, nil
+	}()
+
+	cost := func(leaves map[string]any) int {
+		total := 0
+		for _, l := range c.recentLeaves {
+			total += distance(leaves, l)
+		}
+		return total
+	}
+
+	best, bestCost := -1, 0
+	for i, l := range c.recentLeaves {
+		if total := cost(l); best < 0 || total < bestCost {
+			best, bestCost = i, total
+		}
+	}
+	if best < 0 || bestCost*4 >= cost(c.leaves)*3 {
+		return nil
+	}
+
+	id := c.recent[best]
+	old, ok := s.records.records[id]
+	if !ok {
+		// deleted in the meantime
+		return nil
+	}
+	// the patch is applied to the compacted base, re-compacting the
+	// restored record could store values differently than they were indexed
+	full, err := s.compactedFull(old)
+	if err != nil {
+		return fmt.Errorf("could not promote record %d: %w", id, err)
+	}
+	named, err := s.named(full)
+	if err != nil {
+		return fmt.Errorf("could not promote record %d: %w", id, err)
+	}
+	end := s.database.begin()
+	res := s.unnamed(named)
+	end()
+
+	if err := s.indexRecord(id, old, false); err != nil {
+		return err
+	}
+	s.records.records[id] = res
+	if err := s.indexRecord(id, res, true); err != nil {
+		s.records.records[id] = old
+		s.indexRecord(id, old, true)
+		return err
+	}
+	s.records.bases[c.prototype]--
+
+	s.clusters[group] = append(s.clusters[group], &cluster{prototype: id, leaves: c.recentLeaves[best]})
+	s.log(slog.LevelDebug, "promoted prototype", "group", group, "record", id)
+	return nil
+}
+
+// Prototypes returns the prototype records of all groups, in ascending
+// order.
+func (s *StoreListener) Prototypes() []RecordID {
+	var ids []RecordID
+	for _, clusters := range s.clusters {
+		for _, c := range clusters {
+			ids = append(ids, c.prototype)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// dropPrototype forgets the cluster of a deleted prototype.
+func (s *StoreListener) dropPrototype(id RecordID) {
+	for group, clusters := range s.clusters {
+		for i, c := range clusters {
+			if c.prototype == id {
+				s.clusters[group] = append(clusters[:i], clusters[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// shapeGroup groups records by their set of top-level keys.
+func shapeGroup(data any) string {
+	keys, _, ok := objectFields(data)
+	if !ok {
+		return ""
+	}
+	h := fnv.New64a()
+	h.Write([]byte(strings.Join(keys, "\x00")))
+	return fmt.Sprintf("%x", h.Sum64())
+}
@@ -0,0 +1,143 @@
+package fstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func clusterRecord(t *testing.T, i int, changes map[string]any) map[string]any {
+	var data map[string]any
+	if err := json.Unmarshal(fp2, &data); err != nil {
+		t.Fatal(err)
+	}
+	data["timing_native"] = fmt.Sprintf("run-%d", i)
+	for k, v := range changes {
+		data[k] = v
+	}
+	return data
+}
+
+func TestClustering(t *testing.T) {
+	f := Listener()
+	f.Threshhold = 5
+	f.UseKeyCompression = true
+	f.Clustering.MaxDistance = 20
+	f.Clustering.PromoteEvery = 5
+
+	firefox := map[string]any{}
+	for i := 0; i < 40; i++ {
+		firefox[fmt.Sprintf("firefox_only_%d", i)] = fmt.Sprintf("value-%d", i)
+	}
+	// the population slowly moves away from the first prototype
+	shifted := map[string]any{
+		"userAgent":   "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) Chrome/119.0.0.0",
+		"appVersion":  "5.0 (Macintosh; Intel Mac OS X 10_15_7) Chrome/119.0.0.0",
+		"platform":    "MacIntel-arm",
+		"language":    "en-GB",
+		"vendor":      "Google Inc. (new)",
+		"productSub":  "20030108",
+		"doNotTrack":  "enabled",
+		"innerWidth":  1440.0,
+		"innerHeight": 900.0,
+		"outerWidth":  1440.0,
+	}
+
+	var ids []RecordID
+	var inputs []map[string]any
+	put := func(data map[string]any) {
+		id, err := f.PutClustered(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+		inputs = append(inputs, data)
+	}
+
+	for i := 0; i < 5; i++ {
+		put(clusterRecord(t, i, nil))
+	}
+	for i := 0; i < 5; i++ {
+		put(clusterRecord(t, i, firefox))
+	}
+	if got := f.Prototypes(); !reflect.DeepEqual(got, []RecordID{0, 5}) {
+		t.Fatalf("expected one prototype per population, got %v", got)
+	}
+
+	for i := 0; i < 10; i++ {
+		put(clusterRecord(t, i, shifted))
+	}
+	if got := len(f.Prototypes()); got != 3 {
+		t.Fatalf("expected a promoted prototype for the shifted population, got %v", f.Prototypes())
+	}
+	last, _ := f.Compacted(ids[len(ids)-1])
+	if d, ok := last.(*Delta); !ok || d.Base == 0 {
+		t.Errorf("expected the last record to be a delta to the promoted prototype, got %v", last)
+	}
+
+	for i, id := range ids {
+		got, err := f.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored, _ := f.Store(inputs[i])
+		want, _ := f.Restore(stored)
+		if !reflect.DeepEqual(normalize(got), normalize(want)) {
+			t.Errorf("record %d does not restore to its input", id)
+		}
+	}
+}
+
+type buildRecord struct {
+	Name  string `json:"name"`
+	Build int64  `json:"build"`
+	Extra string `json:"extra"`
+}
+
+func TestPromoteIndex(t *testing.T) {
+	f := Listener()
+	f.Threshhold = 5
+	f.DontHash = []string{"build"}
+	f.Clustering.Group = func(any) string { return "" }
+	f.Clustering.MaxDistance = 5
+	f.Clustering.PromoteEvery = 3
+	if err := f.AddIndex("build"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.PutClustered(buildRecord{Name: "fingerprint", Build: 7, Extra: "first"}); err != nil {
+		t.Fatal(err)
+	}
+	var members []RecordID
+	for i := 0; i < 3; i++ {
+		id, err := f.PutClustered(buildRecord{Name: "other fingerprint", Build: 42, Extra: fmt.Sprintf("member-%d", i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		members = append(members, id)
+	}
+	if len(f.Prototypes()) != 2 {
+		t.Fatalf("expected a promoted prototype, got %v", f.Prototypes())
+	}
+
+	lookup, err := f.Lookup("build", 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query, err := f.Query(Eq("build", 42))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(lookup, members) || !reflect.DeepEqual(query, members) {
+		t.Errorf("lookup found %v, query %v, want %v", lookup, query, members)
+	}
+
+	promoted := f.Prototypes()[1]
+	if err := f.Delete(promoted); err != nil {
+		t.Fatal(err)
+	}
+	if lookup, _ := f.Lookup("build", 42); len(lookup) != 2 {
+		t.Errorf("expected the promoted record to leave the index, got %v", lookup)
+	}
+}
@@ -0,0 +1,383 @@
+// Command fstore compacts, restores and inspects fStore data.
+//
+// Usage:
+//
+//	fstore compact [-dict dict.json] [-threshold n] [-dont-hash a,b] [-keys] [-shapes] [file]
+//	fstore restore [-dict dict.json] [-keys] [file]
+//	fstore dict dump [-dict dict.json] [-kind value|key|shape]
+//	fstore dict stats [-dict dict.json]
+//	fstore diff [-dict dict.json] [-keys] a.json b.json
+//
+// Input is a single JSON document or newline-delimited JSON, read from the
+// file or stdin as a stream. It is taken as newline-delimited if its first
+// line is a whole document; then broken lines are reported and skipped.
+// Results are written to stdout, one document per line. compact adds to
+// the dictionary if it exists and writes it back. -keys is kept in the
+// dictionary, so restore and later compact calls use it without the flag.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"strings"
+
+	fstore "fStore"
+)
+
+const usage = `usage:
+	fstore compact [-dict dict.json] [-threshold n] [-dont-hash a,b] [-keys] [-shapes] [file]
+	fstore restore [-dict dict.json] [-keys] [file]
+	fstore dict dump [-dict dict.json] [-kind value|key|shape]
+	fstore dict stats [-dict dict.json]
+	fstore diff [-dict dict.json] [-keys] a.json b.json`
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("fstore: ")
+	if len(os.Args) < 2 {
+		log.Fatal(usage)
+	}
+
+	var err error
+	switch cmd, args := os.Args[1], os.Args[2:]; cmd {
+	case "compact":
+		err = compact(args, os.Stdin, os.Stdout)
+	case "restore":
+		err = restore(args, os.Stdin, os.Stdout)
+	case "dict":
+		err = dict(args, os.Stdout)
+	case "diff":
+		var same bool
+		if same, err = diff(args, os.Stdout); err == nil && !same {
+			os.Exit(1)
+		}
+	default:
+		log.Fatalf("unknown command %q\n%s", cmd, usage)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func compact(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("compact", flag.ExitOnError)
+	dictFile := flags.String("dict", "dict.json", "dictionary file, extended if it exists")
+	threshold := flags.Int("threshold", 5, "strings shorter than this are kept as they are")
+	dontHash := flags.String("dont-hash", "", "comma separated keys whose values are always hashed")
+	keys := flags.Bool("keys", false, "compress keys, kept in the dictionary")
+	shapes := flags.Bool("shapes", false, "store objects as shapes")
+	flags.Parse(args)
+
+	d, err := readDict(*dictFile, true)
+	if err != nil {
+		return err
+	}
+	s := fstore.Listener()
+	s.Threshhold = *threshold
+	s.UseKeyCompression = *keys || d.CompressedKeys()
+	s.UseShapes = *shapes
+	if *dontHash != "" {
+		s.DontHash = strings.Split(*dontHash, ",")
+	}
+	s.SetDatabase(d)
+
+	in, err := openInput(flags.Arg(0), stdin)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	r, lines, err := peekLines(in)
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriter(stdout)
+	if lines {
+		report, err := s.StoreBatch(r, out, nil)
+		if err != nil {
+			return err
+		}
+		for _, lerr := range report.Errors {
+			log.Print(lerr)
+		}
+	} else {
+		err := eachDocument(r, func(doc []byte) error {
+			res, err := s.StoreJSON(doc)
+			if err != nil {
+				return err
+			}
+			return writeJSON(out, res)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := out.Flush(); err != nil {
+		return err
+	}
+
+	f, err := os.Create(*dictFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := s.Database().WriteTo(f); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func restore(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	dictFile := flags.String("dict", "dict.json", "dictionary file")
+	keys := flags.Bool("keys", false, "keys are compressed, for dictionaries that do not say so")
+	flags.Parse(args)
+
+	s, err := listener(*dictFile, *keys)
+	if err != nil {
+		return err
+	}
+	in, err := openInput(flags.Arg(0), stdin)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out := bufio.NewWriter(stdout)
+	err = eachDocument(in, func(b []byte) error {
+		doc, err := fstore.DecodeJSON(b)
+		if err != nil {
+			return err
+		}
+		res, err := s.Restore(doc)
+		if err != nil {
+			return err
+		}
+		return writeJSON(out, res)
+	})
+	if err != nil {
+		return err
+	}
+	return out.Flush()
+}
+
+func dict(args []string, stdout io.Writer) error {
+	if len(args) < 1 {
+		return errors.New(usage)
+	}
+	flags := flag.NewFlagSet("dict "+args[0], flag.ExitOnError)
+	dictFile := flags.String("dict", "dict.json", "dictionary file")
+	kind := flags.String("kind", "", "only dump entries of this kind: value, key or shape")
+	flags.Parse(args[1:])
+
+	d, err := readDict(*dictFile, false)
+	if err != nil {
+		return err
+	}
+	kinds := []fstore.EntryKind{fstore.ValueEntry, fstore.KeyEntry, fstore.ShapeEntry}
+
+	out := bufio.NewWriter(stdout)
+	switch args[0] {
+	case "dump":
+		for _, k := range kinds {
+			if *kind != "" && *kind != k.String() {
+				continue
+			}
+			for _, e := range d.Entries(k) {
+				v := e.Value
+				if k == fstore.ShapeEntry {
+					b, _ := json.Marshal(e.Keys)
+					v = string(b)
+				}
+				fmt.Fprintf(out, "%s\t%s\t%s\n", k, e.ID, v)
+			}
+		}
+	case "stats":
+		fmt.Fprintf(out, "entries\t%d\n", d.Len())
+		for _, k := range kinds {
+			entries := d.Entries(k)
+			size := 0
+			for _, e := range entries {
+				size += len(e.Value)
+				for _, key := range e.Keys {
+					size += len(key)
+				}
+			}
+			fmt.Fprintf(out, "%s\t%d entries\t%d bytes\n", k, len(entries), size)
+		}
+	default:
+		return fmt.Errorf("unknown dict command %q", args[0])
+	}
+	return out.Flush()
+}
+
+// diff prints the values that differ between two documents, restoring
+// them first if a dictionary is given. It reports whether they are equal.
+func diff(args []string, stdout io.Writer) (bool, error) {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	dictFile := flags.String("dict", "", "dictionary file, if the documents are compacted")
+	keys := flags.Bool("keys", false, "keys are compressed, for dictionaries that do not say so")
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		return false, errors.New(usage)
+	}
+
+	s := fstore.Listener()
+	if *dictFile != "" {
+		var err error
+		if s, err = listener(*dictFile, *keys); err != nil {
+			return false, err
+		}
+	}
+	var sides [2][]leaf
+	for i := range sides {
+		b, err := os.ReadFile(flags.Arg(i))
+		if err != nil {
+			return false, err
+		}
+		doc, err := fstore.DecodeJSON(b)
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", flags.Arg(i), err)
+		}
+		if *dictFile != "" {
+			if doc, err = s.Restore(doc); err != nil {
+				return false, fmt.Errorf("%s: %w", flags.Arg(i), err)
+			}
+		}
+		sides[i] = flatten(doc, "", nil)
+	}
+
+	a, b := index(sides[0]), index(sides[1])
+	out := bufio.NewWriter(stdout)
+	same := true
+	for _, l := range sides[0] {
+		if v, ok := b[l.path]; !ok || v != l.value {
+			fmt.Fprintf(out, "- %s: %s\n", l.path, l.value)
+			same = false
+		}
+	}
+	for _, l := range sides[1] {
+		if v, ok := a[l.path]; !ok || v != l.value {
+			fmt.Fprintf(out, "+ %s: %s\n", l.path, l.value)
+			same = false
+		}
+	}
+	return same, out.Flush()
+}
+
+type leaf struct {
+	path  string
+	value string // JSON
+}
+
+// flatten returns the scalars of a document with their paths, like
+// "tls.extensions[3].name", in document order.
+func flatten(v any, path string, out []leaf) []leaf {
+	switch v := v.(type) {
+	case *fstore.Object:
+		for _, k := range v.Keys {
+			out = flatten(v.Values[k], join(path, k), out)
+		}
+		return out
+	case []any:
+		for i, e := range v {
+			out = flatten(e, fmt.Sprintf("%s[%d]", path, i), out)
+		}
+		return out
+	}
+	b, _ := json.Marshal(v)
+	return append(out, leaf{path: path, value: string(b)})
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func index(leaves []leaf) map[string]string {
+	m := make(map[string]string, len(leaves))
+	for _, l := range leaves {
+		m[l.path] = l.value
+	}
+	return m
+}
+
+func listener(dictFile string, keys bool) (*fstore.StoreListener, error) {
+	d, err := readDict(dictFile, false)
+	if err != nil {
+		return nil, err
+	}
+	s := fstore.Listener()
+	s.UseKeyCompression = keys || d.CompressedKeys()
+	s.SetDatabase(d)
+	return s, nil
+}
+
+// readDict reads a dictionary file. If optional is set, a missing file is
+// an empty dictionary.
+func readDict(name string, optional bool) (fstore.Database, error) {
+	f, err := os.Open(name)
+	if optional && errors.Is(err, fs.ErrNotExist) {
+		return fstore.GetDatabase(), nil
+	}
+	if err != nil {
+		return fstore.Database{}, err
+	}
+	defer f.Close()
+	return fstore.ReadDatabase(f)
+}
+
+// openInput opens the named file, or returns stdin for "" and "-".
+func openInput(name string, stdin io.Reader) (io.ReadCloser, error) {
+	if name == "" || name == "-" {
+		return io.NopCloser(stdin), nil
+	}
+	return os.Open(name)
+}
+
+// peekLines reports whether r holds newline-delimited JSON, that is its
+// first line is a whole document. The returned reader still has all of r.
+func peekLines(r io.Reader) (io.Reader, bool, error) {
+	in := bufio.NewReader(r)
+	first, err := in.ReadBytes('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, false, err
+	}
+	_, err = fstore.DecodeJSON(first)
+	return io.MultiReader(bytes.NewReader(first), in), err == nil, nil
+}
+
+// eachDocument calls fn with every JSON document in r, which can hold a
+// single one or a stream of them.
+func eachDocument(r io.Reader, fn func(doc []byte) error) error {
+	dec := json.NewDecoder(r)
+	for n := 1; ; n++ {
+		var doc json.RawMessage
+		if err := dec.Decode(&doc); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("document %d: %w", n, err)
+		}
+		if err := fn(doc); err != nil {
+			return fmt.Errorf("document %d: %w", n, err)
+		}
+	}
+}
+
+func writeJSON(w io.Writer, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const records = `{"userAgent":"Mozilla/5.0 (X11; Linux x86_64)","platform":"Linux","screen":{"width":1920,"height":1080}}
+{"userAgent":"Mozilla/5.0 (Macintosh)","platform":"MacIntel","$ref":"h_0","languages":["en-US","de-DE"]}
+`
+
+func TestCompactRestore(t *testing.T) {
+	for _, flags := range [][]string{nil, {"-keys"}, {"-shapes"}, {"-keys", "-dont-hash", "platform"}} {
+		dictFile := filepath.Join(t.TempDir(), "dict.json")
+		var compacted bytes.Buffer
+		args := append([]string{"-dict", dictFile}, flags...)
+		if err := compact(args, strings.NewReader(records), &compacted); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(compacted.String(), "Mozilla") {
+			t.Errorf("%v: long values were not compacted: %s", flags, compacted.String())
+		}
+
+		// -keys is read from the dictionary
+		var restored bytes.Buffer
+		if err := restore([]string{"-dict", dictFile}, &compacted, &restored); err != nil {
+			t.Fatal(err)
+		}
+		if restored.String() != records {
+			t.Errorf("%v: restored\n%s\nwant\n%s", flags, restored.String(), records)
+		}
+	}
+}
+
+func TestCompactDocument(t *testing.T) {
+	dictFile := filepath.Join(t.TempDir(), "dict.json")
+	in := "{\n  \"userAgent\": \"Mozilla/5.0 (X11; Linux x86_64)\",\n  \"n\": 8\n}\n"
+	var compacted bytes.Buffer
+	if err := compact([]string{"-dict", dictFile, "-keys"}, strings.NewReader(in), &compacted); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(compacted.String(), "\n"); lines != 1 {
+		t.Errorf("expected one compacted document, got %q", compacted.String())
+	}
+	var restored bytes.Buffer
+	if err := restore([]string{"-dict", dictFile}, &compacted, &restored); err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"userAgent":"Mozilla/5.0 (X11; Linux x86_64)","n":8}` + "\n"; restored.String() != want {
+		t.Errorf("restored %q, want %q", restored.String(), want)
+	}
+
+	var dump bytes.Buffer
+	if err := dict([]string{"dump", "-dict", dictFile, "-kind", "key"}, &dump); err != nil {
+		t.Fatal(err)
+	}
+	if want := "key\th_0\tuserAgent\nkey\th_1\tn\n"; dump.String() != want {
+		t.Errorf("dumped %q, want %q", dump.String(), want)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.json"), filepath.Join(dir, "b.json")
+	write(t, a, `{"platform":"Linux","screen":{"width":1920}}`)
+	write(t, b, `{"platform":"Linux","screen":{"width":2560}}`)
+
+	var out bytes.Buffer
+	same, err := diff([]string{a, b}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "- screen.width: 1920\n+ screen.width: 2560\n"; same || out.String() != want {
+		t.Errorf("got %v %q, want %q", same, out.String(), want)
+	}
+}
+
+func write(t *testing.T, name, data string) {
+	t.Helper()
+	if err := os.WriteFile(name, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,105 @@
+// Command fstored serves a StoreListener over HTTP, see fstore.Handler.
+//
+//	fstored -addr :8080 -dict dict.json -keys
+//
+// The dictionary is read at start, if it exists, and written back on
+// shutdown. Records are kept in memory only.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	fstore "fStore"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to listen on")
+	dictFile := flag.String("dict", "", "dictionary file, read at start and written on shutdown")
+	threshold := flag.Int("threshold", 5, "strings shorter than this are kept as they are")
+	dontHash := flag.String("dont-hash", "", "comma separated keys whose values are always hashed")
+	keys := flag.Bool("keys", false, "compress keys")
+	shapes := flag.Bool("shapes", false, "store objects as shapes")
+	flag.Parse()
+	log.SetPrefix("fstored: ")
+
+	s := fstore.Listener()
+	s.Threshhold = *threshold
+	s.UseKeyCompression = *keys
+	s.UseShapes = *shapes
+	s.CollectStats = true
+	if *dontHash != "" {
+		s.DontHash = strings.Split(*dontHash, ",")
+	}
+	if *dictFile != "" {
+		if err := readDict(s, *dictFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	srv := &http.Server{Addr: *addr, Handler: fstore.NewHandler(s)}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// ListenAndServe returns as soon as the shutdown starts, done is closed
+	// once running requests have finished
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-ctx.Done()
+		if err := srv.Shutdown(context.Background()); err != nil {
+			log.Print(err)
+		}
+	}()
+
+	log.Printf("listening on %s", *addr)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	<-done
+	if *dictFile != "" {
+		if err := writeDict(s, *dictFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func readDict(s *fstore.StoreListener, name string) error {
+	f, err := os.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	d, err := fstore.ReadDatabase(f)
+	if err != nil {
+		return err
+	}
+	// records stored against the dictionary before use its key ids
+	s.UseKeyCompression = s.UseKeyCompression || d.CompressedKeys()
+	s.SetDatabase(d)
+	return nil
+}
+
+// writeDict writes the dictionary once the server has shut down, so no
+// request uses the listener anymore.
+func writeDict(s *fstore.StoreListener, name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := s.Database().WriteTo(f); err != nil {
+		return err
+	}
+	return f.Close()
+}
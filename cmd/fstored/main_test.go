@@ -0,0 +1,45 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	fstore "fStore"
+)
+
+func TestDictFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "dict.json")
+	// a missing dictionary is not an error
+	if err := readDict(fstore.Listener(), name); err != nil {
+		t.Fatal(err)
+	}
+
+	s := fstore.Listener()
+	s.Threshhold = 5
+	s.UseKeyCompression = true
+	data := map[string]any{"userAgent": "Mozilla/5.0 (X11; Linux x86_64)", "platform": "Linux"}
+	res, err := s.Store(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeDict(s, name); err != nil {
+		t.Fatal(err)
+	}
+
+	// started again without -keys
+	again := fstore.Listener()
+	if err := readDict(again, name); err != nil {
+		t.Fatal(err)
+	}
+	if !again.UseKeyCompression {
+		t.Error("expected key compression to be taken from the dictionary")
+	}
+	got, err := again.Restore(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, data) {
+		t.Errorf("restored %v, want %v", got, data)
+	}
+}
@@ -0,0 +1,345 @@
+// Command fstoregen generates reflection-free compactors for struct types.
+//
+// Types annotated with a //fstore:generate comment get a CompactT and a
+// RestoreT function, which follow the same dictionary and policy semantics
+// as StoreListener.Store and StoreListener.RestoreInto:
+//
+//	//go:generate go run fStore/cmd/fstoregen -file fingerprint.go
+//
+//	//fstore:generate
+//	type Fingerprint struct { ... }
+//
+// Fields of types the generator does not know (maps, types from other
+// packages, ...) fall back to the reflective walker, so registered codecs
+// still apply to them. Paths in logs and errors are relative to the
+// generated type.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"log"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const annotation = "//fstore:generate"
+
+func main() {
+	file := flag.String("file", os.Getenv("GOFILE"), "file containing the annotated types")
+	output := flag.String("output", "", "output file (default <file>_fstore.go)")
+	importPath := flag.String("import", "fStore", "import path of the fstore package")
+	flag.Parse()
+
+	if *file == "" {
+		log.Fatal("fstoregen: no input file, use -file")
+	}
+	if *output == "" {
+		*output = outputName(*file)
+	}
+
+	src, err := generate(*file, *importPath)
+	if err != nil {
+		log.Fatalf("fstoregen: %v", err)
+	}
+	if err := os.WriteFile(*output, src, 0o644); err != nil {
+		log.Fatalf("fstoregen: %v", err)
+	}
+}
+
+// outputName returns the default output file for the input file name.
+func outputName(file string) string {
+	if base, ok := strings.CutSuffix(file, "_test.go"); ok {
+		return base + "_fstore_test.go"
+	}
+	return strings.TrimSuffix(file, ".go") + "_fstore.go"
+}
+
+type generator struct {
+	buf   bytes.Buffer
+	fset  *token.FileSet
+	q     string          // qualifier for the fstore package, empty inside it
+	types map[string]bool // annotated types
+	n     int             // counter for temporary variables
+}
+
+func generate(file, importPath string) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, file, nil, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &generator{fset: fset, q: "fstore.", types: map[string]bool{}}
+	if f.Name.Name == "fstore" {
+		g.q = ""
+	}
+
+	var specs []*ast.TypeSpec
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			ts := spec.(*ast.TypeSpec)
+			if !annotated(gen.Doc) && !annotated(ts.Doc) {
+				continue
+			}
+			if _, ok := ts.Type.(*ast.StructType); !ok {
+				return nil, fmt.Errorf("%s: %s is not a struct type", fset.Position(ts.Pos()), ts.Name.Name)
+			}
+			specs = append(specs, ts)
+			g.types[ts.Name.Name] = true
+		}
+	}
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("%s: no type is annotated with %s", file, annotation)
+	}
+
+	g.printf("// Code generated by fstoregen. DO NOT EDIT.\n\n")
+	g.printf("package %s\n\n", f.Name.Name)
+	if g.q != "" {
+		g.printf("import fstore %q\n\n", importPath)
+	}
+	for _, ts := range specs {
+		if err := g.generateType(ts); err != nil {
+			return nil, err
+		}
+	}
+
+	src, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("could not format generated code: %w\n%s", err, g.buf.Bytes())
+	}
+	return src, nil
+}
+
+func annotated(doc *ast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+	for _, c := range doc.List {
+		if strings.TrimSpace(c.Text) == annotation {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *generator) printf(format string, args ...any) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *generator) tmp(prefix string) string {
+	g.n++
+	return fmt.Sprintf("%s%d", prefix, g.n)
+}
+
+func (g *generator) expr(e ast.Expr) string {
+	var buf bytes.Buffer
+	printer.Fprint(&buf, g.fset, e)
+	return buf.String()
+}
+
+func (g *generator) generateType(ts *ast.TypeSpec) error {
+	name := ts.Name.Name
+	listener := "*" + g.q + "StoreListener"
+
+	g.printf("// Compact%s compacts v like StoreListener.Store would, without reflection.\n", name)
+	g.printf("func Compact%s(s %s, v *%s) (any, error) {\n", name, listener, name)
+	res, err := g.compact(ts.Type, "(*v)", "", "")
+	if err != nil {
+		return err
+	}
+	g.printf("return %s, nil\n}\n\n", res)
+
+	g.printf("// Restore%s restores data, a result of Compact%s or Store, into v.\n", name, name)
+	g.printf("func Restore%s(s %s, data any, v *%s) error {\n", name, listener, name)
+	g.printf("r, err := s.Restore(data)\nif err != nil {\nreturn err\n}\n")
+	g.printf("return decode%s(s, r, v)\n}\n\n", name)
+
+	g.printf("func decode%s(s %s, data any, v *%s) error {\n", name, listener, name)
+	if err := g.restore(ts.Type, "data", "(*v)"); err != nil {
+		return err
+	}
+	g.printf("return nil\n}\n\n")
+	return nil
+}
+
+type field struct {
+	goName string
+	name   string // stored name, taken from the json tag
+	typ    ast.Expr
+}
+
+// fields lists the fields of st, using the same naming as the walker.
+func (g *generator) fields(st *ast.StructType) ([]field, error) {
+	var res []field
+	for _, f := range st.Fields.List {
+		if len(f.Names) == 0 {
+			return nil, fmt.Errorf("%s: embedded fields are not supported", g.fset.Position(f.Pos()))
+		}
+		tag := ""
+		if f.Tag != nil {
+			unquoted, err := strconv.Unquote(f.Tag.Value)
+			if err != nil {
+				return nil, err
+			}
+			tag = reflect.StructTag(unquoted).Get("json")
+		}
+		name := strings.Replace(tag, ",omitonempty", "", -1)
+		name = strings.Replace(name, ",omitempty", "", -1)
+
+		for _, n := range f.Names {
+			if !n.IsExported() {
+				return nil, fmt.Errorf("%s: unexported field %s is not supported", g.fset.Position(n.Pos()), n.Name)
+			}
+			res = append(res, field{goName: n.Name, name: name, typ: f.Type})
+		}
+	}
+	return res, nil
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// compact emits the statements compacting src, a value of type t, and
+// returns the expression holding the result.
+func (g *generator) compact(t ast.Expr, src, name, path string) (string, error) {
+	switch t := t.(type) {
+	case *ast.Ident:
+		switch t.Name {
+		case "string":
+			return fmt.Sprintf("s.CompactString(%q, %q, %s)", name, path, src), nil
+		case "float64":
+			return fmt.Sprintf("s.CompactFloat(%q, %q, %s)", name, path, src), nil
+		case "int64":
+			return fmt.Sprintf("s.CompactInt64(%q, %q, %s)", name, path, src), nil
+		case "int":
+			return fmt.Sprintf("int64(%s)", src), nil
+		case "bool", "int8", "int16", "int32", "uint", "uint8", "uint16", "uint32", "uint64", "float32":
+			return src, nil
+		}
+		if g.types[t.Name] {
+			res := g.tmp("c")
+			g.printf("%s, err := Compact%s(s, &%s)\nif err != nil {\nreturn nil, err\n}\n", res, t.Name, src)
+			return res, nil
+		}
+	case *ast.StructType:
+		fields, err := g.fields(t)
+		if err != nil {
+			return "", err
+		}
+		m := g.tmp("m")
+		g.printf("%s := s.NewFieldSet()\n", m)
+		for _, f := range fields {
+			val, err := g.compact(f.typ, src+"."+f.goName, f.name, joinPath(path, f.name))
+			if err != nil {
+				return "", err
+			}
+			g.printf("%s.Set(%q, %s)\n", m, f.name, val)
+		}
+		return m + ".Value()", nil
+	case *ast.ArrayType:
+		a, i := g.tmp("a"), g.tmp("i")
+		g.printf("%s := make([]any, 0, len(%s))\n", a, src)
+		g.printf("for %s := range %s {\n", i, src)
+		val, err := g.compact(t.Elt, fmt.Sprintf("%s[%s]", src, i), "", path+"[]")
+		if err != nil {
+			return "", err
+		}
+		g.printf("%s = append(%s, %s)\n}\n", a, a, val)
+		return a, nil
+	case *ast.StarExpr:
+		p := g.tmp("p")
+		g.printf("var %s any\nif %s != nil {\n", p, src)
+		val, err := g.compact(t.X, "(*"+src+")", name, path)
+		if err != nil {
+			return "", err
+		}
+		g.printf("%s = %s\n}\n", p, val)
+		return p, nil
+	}
+
+	res := g.tmp("r")
+	g.printf("%s, err := s.CompactValue(%q, %q, %s)\nif err != nil {\nreturn nil, err\n}\n", res, name, path, src)
+	return res, nil
+}
+
+// restore emits the statements storing src, restored data of type any, in
+// dst, an addressable value of type t.
+func (g *generator) restore(t ast.Expr, src, dst string) error {
+	switch t := t.(type) {
+	case *ast.Ident:
+		switch t.Name {
+		case "string":
+			g.printf("%s = %sRestoredString(%s)\n", dst, g.q, src)
+			return nil
+		case "bool":
+			g.printf("%s = %sRestoredBool(%s)\n", dst, g.q, src)
+			return nil
+		case "float64", "float32":
+			g.printf("%s = %s(%sRestoredFloat(%s))\n", dst, t.Name, g.q, src)
+			return nil
+		case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64":
+			g.printf("%s = %s(%sRestoredInt(%s))\n", dst, t.Name, g.q, src)
+			return nil
+		}
+		if g.types[t.Name] {
+			g.printf("if err := decode%s(s, %s, &%s); err != nil {\nreturn err\n}\n", t.Name, src, dst)
+			return nil
+		}
+	case *ast.StructType:
+		fields, err := g.fields(t)
+		if err != nil {
+			return err
+		}
+		m := g.tmp("m")
+		g.printf("if %s, ok := %sRestoredFields(%s); ok {\n", m, g.q, src)
+		for _, f := range fields {
+			if err := g.restore(f.typ, fmt.Sprintf("%s[%q]", m, f.name), dst+"."+f.goName); err != nil {
+				return err
+			}
+		}
+		g.printf("}\n")
+		return nil
+	case *ast.ArrayType:
+		a, i, e := g.tmp("a"), g.tmp("i"), g.tmp("e")
+		g.printf("if %s, ok := %s.([]any); ok {\n", a, src)
+		if t.Len == nil {
+			g.printf("%s = make(%s, len(%s))\n", dst, g.expr(t), a)
+		}
+		g.printf("for %s, %s := range %s {\n", i, e, a)
+		if t.Len != nil {
+			g.printf("if %s >= len(%s) {\nbreak\n}\n", i, dst)
+		}
+		if err := g.restore(t.Elt, e, fmt.Sprintf("%s[%s]", dst, i)); err != nil {
+			return err
+		}
+		g.printf("}\n}\n")
+		return nil
+	case *ast.StarExpr:
+		g.printf("if %s != nil {\n%s = new(%s)\n", src, dst, g.expr(t.X))
+		if err := g.restore(t.X, src, "(*"+dst+")"); err != nil {
+			return err
+		}
+		g.printf("}\n")
+		return nil
+	}
+
+	g.printf("if err := s.Decode(%s, &%s); err != nil {\nreturn err\n}\n", src, dst)
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	src, err := generate(filepath.Join("testdata", "record.go"), "fStore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "record_fstore.go", src, 0); err != nil {
+		t.Fatalf("generated code does not parse: %v\n%s", err, src)
+	}
+	for _, want := range []string{
+		`import fstore "fStore"`,
+		"func CompactRecord(s *fstore.StoreListener, v *Record) (any, error)",
+		"func RestoreRecord(s *fstore.StoreListener, data any, v *Record) error",
+		"func CompactScreen(",
+		`s.CompactValue("headers", "headers", (*v).Headers)`,
+	} {
+		if !strings.Contains(string(src), want) {
+			t.Errorf("generated code has no %q\n%s", want, src)
+		}
+	}
+	if strings.Contains(string(src), "CompactOther") {
+		t.Error("generated code for a type without annotation")
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	dir := t.TempDir()
+	for name, src := range map[string]string{
+		"none.go":       "package p\n\ntype T struct{ A string }\n",
+		"unexported.go": "package p\n\n//fstore:generate\ntype T struct{ a string }\n",
+		"notstruct.go":  "package p\n\n//fstore:generate\ntype T int\n",
+	} {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := generate(file, "fStore"); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestOutputName(t *testing.T) {
+	for in, want := range map[string]string{"fp.go": "fp_fstore.go", "fp_test.go": "fp_fstore_test.go"} {
+		if got := outputName(in); got != want {
+			t.Errorf("outputName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package testdata
+
+//fstore:generate
+type Record struct {
+	Name    string            `json:"name"`
+	Cores   int               `json:"cores"`
+	Tags    []string          `json:"tags"`
+	Screen  *Screen           `json:"screen"`
+	Headers map[string]string `json:"headers"`
+}
+
+//fstore:generate
+type Screen struct {
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// Other is not annotated.
+type Other struct {
+	Name string
+}
@@ -0,0 +1,130 @@
+package fstore
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Codec converts values of a type into a representation the walker can
+// compact (usually a string, so it ends up in the dictionary) and back.
+type Codec interface {
+	// Encode returns the compactable representation of v.
+	Encode(v reflect.Value) (any, error)
+	// Decode turns a restored representation back into a value of type t.
+	Decode(data any, t reflect.Type) (reflect.Value, error)
+}
+
+var (
+	jsonMarshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// RegisterCodec makes the walker use c for every value of type t. Types
+// implementing json.Marshaler or encoding.TextMarshaler use those by default.
+func (s *StoreListener) RegisterCodec(t reflect.Type, c Codec) {
+	if s.codecs == nil {
+		s.codecs = map[reflect.Type]Codec{}
+	}
+	s.codecs[t] = c
+	s.resetPlans()
+}
+
+func implements(t, iface reflect.Type) bool {
+	return t.Implements(iface) || reflect.PointerTo(t).Implements(iface)
+}
+
+// codecFor returns the codec for values of type t, or nil if they should
+// be walked as usual.
+func (s *StoreListener) codecFor(t reflect.Type) Codec {
+	if c, ok := s.codecs[t]; ok {
+		return c
+	}
+	if t.Kind() == reflect.Interface {
+		return nil
+	}
+	// same precedence as encoding/json
+	if implements(t, jsonMarshalerType) || implements(t, jsonUnmarshalerType) {
+		return jsonCodec{}
+	}
+	if implements(t, textMarshalerType) || implements(t, textUnmarshalerType) {
+		return textCodec{}
+	}
+	return nil
+}
+
+// addressed returns a pointer to v, or to a copy of it if v is not
+// addressable, so methods with pointer receivers are found as well.
+func addressed(v reflect.Value) any {
+	if !v.CanAddr() {
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		v = c
+	}
+	return v.Addr().Interface()
+}
+
+// jsonCodec stores values implementing json.Marshaler as the value tree
+// their JSON decodes to.
+type jsonCodec struct{}
+
+func (jsonCodec) Encode(v reflect.Value) (any, error) {
+	b, err := json.Marshal(addressed(v))
+	if err != nil {
+		return nil, err
+	}
+	var res any
+	if err := json.Unmarshal(b, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (jsonCodec) Decode(data any, t reflect.Type) (reflect.Value, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	res := reflect.New(t)
+	if err := json.Unmarshal(b, res.Interface()); err != nil {
+		return reflect.Value{}, err
+	}
+	return res.Elem(), nil
+}
+
+// textCodec stores values implementing encoding.TextMarshaler as strings.
+type textCodec struct{}
+
+func (textCodec) Encode(v reflect.Value) (any, error) {
+	m, ok := v.Interface().(encoding.TextMarshaler)
+	if !ok {
+		m, ok = addressed(v).(encoding.TextMarshaler)
+	}
+	if !ok {
+		return nil, fmt.Errorf("%s does not implement encoding.TextMarshaler", v.Type())
+	}
+	b, err := m.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (textCodec) Decode(data any, t reflect.Type) (reflect.Value, error) {
+	str, ok := data.(string)
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("could not decode %T into %s", data, t)
+	}
+	res := reflect.New(t)
+	u, ok := res.Interface().(encoding.TextUnmarshaler)
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("%s does not implement encoding.TextUnmarshaler", t)
+	}
+	if err := u.UnmarshalText([]byte(str)); err != nil {
+		return reflect.Value{}, err
+	}
+	return res.Elem(), nil
+}
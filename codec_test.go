@@ -0,0 +1,126 @@
+package fstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type level int
+
+var levelNames = []string{"low", "medium", "high"}
+
+type levelCodec struct{}
+
+func (levelCodec) Encode(v reflect.Value) (any, error) {
+	return levelNames[v.Int()], nil
+}
+
+func (levelCodec) Decode(data any, t reflect.Type) (reflect.Value, error) {
+	for i, name := range levelNames {
+		if name == data {
+			return reflect.ValueOf(level(i)).Convert(t), nil
+		}
+	}
+	return reflect.Value{}, fmt.Errorf("unknown level %v", data)
+}
+
+type codecRecord struct {
+	Seen  time.Time      `json:"seen"`
+	IP    net.IP         `json:"ip"`
+	Level level          `json:"level"`
+	Big   big.Int        `json:"big"`
+	Addr  netip.AddrPort `json:"addr"`
+}
+
+func TestCodecs(t *testing.T) {
+	f := Listener()
+	f.Threshhold = 5
+	f.RegisterCodec(reflect.TypeOf(level(0)), levelCodec{})
+
+	in := codecRecord{
+		Seen:  time.Date(2023, 10, 6, 14, 0, 11, 0, time.UTC),
+		IP:    net.ParseIP("1.1.1.1"),
+		Level: 2,
+		Addr:  netip.MustParseAddrPort("[::1]:8080"),
+	}
+	in.Big.SetString("100000000000000000000", 10)
+	res, err := f.Store(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := res.(map[string]any)
+	if v, _ := f.Database().Lookup(m["seen"].(string)); v != "2023-10-06T14:00:11Z" {
+		t.Errorf("expected time to be stored as text, got %v", m["seen"])
+	}
+	if v, _ := f.Database().Lookup(m["ip"].(string)); v != "1.1.1.1" {
+		t.Errorf("expected ip to be stored as text, got %v", m["ip"])
+	}
+	if m["level"] != "high" {
+		t.Errorf("expected the registered codec to be used, got %v", m["level"])
+	}
+	if m["big"] != 1e20 {
+		t.Errorf("expected big.Int to be stored as a number, got %v", m["big"])
+	}
+	if v, _ := f.Database().Lookup(m["addr"].(string)); v != "[::1]:8080" {
+		t.Errorf("expected the address to be stored as text, got %v", m["addr"])
+	}
+
+	var out codecRecord
+	if err := f.RestoreInto(res, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !out.Seen.Equal(in.Seen) || !out.IP.Equal(in.IP) || out.Level != in.Level || out.Big.Cmp(&in.Big) != 0 || out.Addr != in.Addr {
+		t.Errorf("restored %+v, want %+v", out, in)
+	}
+
+	// values behind pointers are not addressable in the walker
+	if res, err = f.Store(&in); err != nil {
+		t.Fatal(err)
+	}
+	if m := res.(map[string]any); m["big"] != 1e20 {
+		t.Errorf("expected big.Int behind a pointer to be stored, got %v", m["big"])
+	}
+}
+
+type bigRecord struct {
+	Signed   int64  `json:"signed"`
+	Unsigned uint64 `json:"unsigned"`
+}
+
+func TestLargeIntegers(t *testing.T) {
+	in := bigRecord{Signed: math.MaxInt64, Unsigned: math.MaxUint64}
+	for _, dontHash := range [][]string{nil, {"signed", "unsigned"}} {
+		f := Listener()
+		f.DontHash = dontHash
+		res, err := f.Store(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bigRecord
+		if err := f.RestoreInto(res, &out); err != nil {
+			t.Fatal(err)
+		}
+		if out != in {
+			t.Errorf("DontHash %v: restored %+v, want %+v", dontHash, out, in)
+		}
+	}
+
+	if got := RestoredInt(json.Number("9223372036854775807")); got != math.MaxInt64 {
+		t.Errorf("RestoredInt returned %d, want %d", got, int64(math.MaxInt64))
+	}
+}
+
+func TestRegisterCodecZeroValue(t *testing.T) {
+	var f StoreListener
+	f.RegisterCodec(reflect.TypeOf(level(0)), levelCodec{})
+	if _, ok := f.codecs[reflect.TypeOf(level(0))]; !ok {
+		t.Error("expected the codec to be registered")
+	}
+}
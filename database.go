@@ -1,44 +1,400 @@
 package fstore
 
-import "fmt"
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
 
 type Database struct {
 	hashValues map[string]string
 	hashKeys   map[string]string
+	// shapes are ordered key lists, see Shaped
+	shapes map[string][]string
+	// reverse lookups, value -> id
+	valueIDs map[string]string
+	keyIDs   map[string]string
+	shapeIDs map[string]string
+	// entries by sequence number, appended only, see Snapshot
+	valueList []string
+	keyList   []string
+	shapeList [][]string
+	counters  dictCounters
+	usage     map[entryRef]*usage
+	// records use key ids of this dictionary, see CompressedKeys
+	compressedKeys bool
+	// time of the running Store call, so its entries share one timestamp
+	now time.Time
+}
+
+// EntryKind tells the dictionaries of a Database apart. Values and keys
+// both use ids like "h_3", so an id is only unique within its kind.
+type EntryKind int
+
+const (
+	ValueEntry EntryKind = iota
+	KeyEntry
+	ShapeEntry
+)
+
+func (k EntryKind) String() string {
+	switch k {
+	case ValueEntry:
+		return "value"
+	case KeyEntry:
+		return "key"
+	case ShapeEntry:
+		return "shape"
+	}
+	return fmt.Sprintf("EntryKind(%d)", int(k))
+}
+
+// MarshalText encodes the kind by its name, like "value".
+func (k EntryKind) MarshalText() ([]byte, error) {
+	switch k {
+	case ValueEntry, KeyEntry, ShapeEntry:
+		return []byte(k.String()), nil
+	}
+	return nil, fmt.Errorf("invalid entry kind %d", int(k))
+}
+
+// UnmarshalText decodes a kind encoded by MarshalText.
+func (k *EntryKind) UnmarshalText(b []byte) error {
+	for _, kind := range []EntryKind{ValueEntry, KeyEntry, ShapeEntry} {
+		if string(b) == kind.String() {
+			*k = kind
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown entry kind %q", b)
+}
+
+type entryRef struct {
+	kind EntryKind
+	id   string
+}
+
+type usage struct {
+	refs      int
+	firstSeen time.Time
+	lastSeen  time.Time
+}
+
+// Entry is a dictionary entry with its usage. Refs counts how often the
+// entry has been stored since the Database was created or read, FirstSeen
+// and LastSeen are zero for entries that have not been stored since.
+type Entry struct {
+	Kind      EntryKind `json:"kind"`
+	ID        string    `json:"id"`
+	Value     string    `json:"value,omitempty"` // the value or key, empty for shapes
+	Keys      []string  `json:"keys,omitempty"`  // the keys of a shape
+	Refs      int       `json:"refs"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// dictCounters tracks how the dictionary has been used, so callers can
+// work out how much a single Store call added to it.
+type dictCounters struct {
+	newEntries    int
+	reusedEntries int
+	bytesAdded    int
 }
 
 func GetDatabase() Database {
 	return Database{
 		hashValues: map[string]string{},
 		hashKeys:   map[string]string{},
+		shapes:     map[string][]string{},
+		valueIDs:   map[string]string{},
+		keyIDs:     map[string]string{},
+		shapeIDs:   map[string]string{},
+		usage:      map[entryRef]*usage{},
 	}
 }
 
-func isInMap(m map[string]string, key string) string {
-	for k, v := range m {
-		if v == key {
-			return k
-		}
+func (d *Database) save(kind EntryKind, m, ids map[string]string, val string) string {
+	if r, ok := ids[val]; ok {
+		d.reuse(kind, r)
+		return r
 	}
-	return ""
+	h := fmt.Sprintf("h_%v", len(m))
+	d.add(kind, h, val, nil)
+	d.counters.newEntries++
+	d.counters.bytesAdded += len(h) + len(val)
+	d.use(kind, h)
+	return h
 }
 
-func (d *Database) SaveHash(val string) string {
-	r := isInMap(d.hashValues, val)
-	if r != "" {
-		return r
+// begin stamps all entries used until the returned func is called with
+// the same time.
+func (d *Database) begin() func() {
+	d.now = time.Now()
+	return func() { d.now = time.Time{} }
+}
+
+// reuse records another reference to an existing entry.
+func (d *Database) reuse(kind EntryKind, id string) {
+	d.counters.reusedEntries++
+	d.use(kind, id)
+}
+
+func (d *Database) use(kind EntryKind, id string) {
+	if d.usage == nil {
+		d.usage = map[entryRef]*usage{}
 	}
-	h := fmt.Sprintf("h_%v", len(d.hashValues))
-	d.hashValues[h] = val
-	return h
+	now := d.now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	u, ok := d.usage[entryRef{kind, id}]
+	if !ok {
+		u = &usage{firstSeen: now}
+		d.usage[entryRef{kind, id}] = u
+	}
+	u.refs++
+	u.lastSeen = now
+}
+
+func (d *Database) SaveHash(val string) string {
+	return d.save(ValueEntry, d.hashValues, d.valueIDs, val)
 }
 
 func (d *Database) SaveKey(val string) string {
-	r := isInMap(d.hashKeys, val)
-	if r != "" {
-		return r
+	return d.save(KeyEntry, d.hashKeys, d.keyIDs, val)
+}
+
+// Lookup returns the value behind a value id.
+func (d *Database) Lookup(id string) (string, bool) {
+	v, ok := d.hashValues[id]
+	return v, ok
+}
+
+// LookupKey returns the key behind a key id.
+func (d *Database) LookupKey(id string) (string, bool) {
+	k, ok := d.hashKeys[id]
+	return k, ok
+}
+
+// LookupShape returns a copy of the keys of a shape.
+func (d *Database) LookupShape(id string) ([]string, bool) {
+	keys, ok := d.shapes[id]
+	return slices.Clone(keys), ok
+}
+
+// IDOf returns the id of a value, if it has been stored.
+func (d *Database) IDOf(value string) (string, bool) {
+	id, ok := d.valueIDs[value]
+	return id, ok
+}
+
+// KeyIDOf returns the id of a key, if it has been stored.
+func (d *Database) KeyIDOf(key string) (string, bool) {
+	id, ok := d.keyIDs[key]
+	return id, ok
+}
+
+// Len returns the number of entries of all kinds.
+func (d *Database) Len() int {
+	return len(d.hashValues) + len(d.hashKeys) + len(d.shapes)
+}
+
+// Entry returns an entry and its usage.
+func (d *Database) Entry(kind EntryKind, id string) (Entry, bool) {
+	e := Entry{Kind: kind, ID: id}
+	var ok bool
+	switch kind {
+	case ValueEntry:
+		e.Value, ok = d.hashValues[id]
+	case KeyEntry:
+		e.Value, ok = d.hashKeys[id]
+	case ShapeEntry:
+		e.Keys, ok = d.shapes[id]
+		// shared with snapshots, see Snapshot
+		e.Keys = slices.Clone(e.Keys)
 	}
-	h := fmt.Sprintf("h_%v", len(d.hashKeys))
-	d.hashKeys[h] = val
-	return h
+	if !ok {
+		return Entry{}, false
+	}
+	if u, ok := d.usage[entryRef{kind, id}]; ok {
+		e.Refs, e.FirstSeen, e.LastSeen = u.refs, u.firstSeen, u.lastSeen
+	}
+	return e, true
+}
+
+// Entries returns the entries of a kind, in the order they were added.
+func (d *Database) Entries(kind EntryKind) []Entry {
+	var ids []string
+	switch kind {
+	case ValueEntry:
+		ids = sortedIDs(d.hashValues)
+	case KeyEntry:
+		ids = sortedIDs(d.hashKeys)
+	case ShapeEntry:
+		ids = sortedIDs(d.shapes)
+	}
+
+	entries := make([]Entry, len(ids))
+	for i, id := range ids {
+		entries[i], _ = d.Entry(kind, id)
+	}
+	return entries
+}
+
+// entrySeq returns the number of an id like "h_12".
+func entrySeq(id string) int {
+	_, n, _ := strings.Cut(id, "_")
+	i, _ := strconv.Atoi(n)
+	return i
+}
+
+// IsRef reports whether str is a value id like "h_12". Compacted records
+// never hold literals of that form, see EscapeLiteral.
+func IsRef(str string) bool {
+	n, ok := strings.CutPrefix(str, "h_")
+	if !ok || n == "" {
+		return false
+	}
+	for _, c := range n {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// EscapeLiteral escapes a string that is kept verbatim, so it cannot be
+// mistaken for a value id: "h_3" becomes "~h_3", "~h_3" becomes "~~h_3".
+// Other strings are returned as they are.
+func EscapeLiteral(str string) string {
+	if IsRef(strings.TrimLeft(str, "~")) {
+		return "~" + str
+	}
+	return str
+}
+
+// UnescapeLiteral reverses EscapeLiteral.
+func UnescapeLiteral(str string) string {
+	if strings.HasPrefix(str, "~") && IsRef(strings.TrimLeft(str, "~")) {
+		return str[1:]
+	}
+	return str
+}
+
+// EscapeKey escapes a key that is stored as it is, without key compression,
+// so it cannot be mistaken for the markers of shapes, deltas and versioned
+// records: keys starting with "$" get another "$".
+func EscapeKey(k string) string {
+	if strings.HasPrefix(k, "$") {
+		return "$" + k
+	}
+	return k
+}
+
+// UnescapeKey reverses EscapeKey.
+func UnescapeKey(k string) string {
+	if strings.HasPrefix(k, "$$") {
+		return k[1:]
+	}
+	return k
+}
+
+// CompressedKeys reports whether records were stored against the
+// dictionary with UseKeyCompression, so their keys are ids of it. It is
+// kept in the dictionary file, tools reading one can restore the records
+// without being told the setting.
+func (d *Database) CompressedKeys() bool {
+	return d.compressedKeys
+}
+
+// dictionaryFile is the serialized form of a Database.
+type dictionaryFile struct {
+	Values         map[string]string   `json:"values"`
+	Keys           map[string]string   `json:"keys"`
+	Shapes         map[string][]string `json:"shapes,omitempty"`
+	CompressedKeys bool                `json:"compressed_keys,omitempty"`
+}
+
+// WriteTo writes the dictionary to w as JSON.
+func (d *Database) WriteTo(w io.Writer) (int64, error) {
+	b, err := json.Marshal(dictionaryFile{Values: d.hashValues, Keys: d.hashKeys, Shapes: d.shapes, CompressedKeys: d.compressedKeys})
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(append(b, '\n'))
+	return int64(n), err
+}
+
+// ReadDatabase reads a dictionary written by Database.WriteTo.
+func ReadDatabase(r io.Reader) (Database, error) {
+	var f dictionaryFile
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return Database{}, fmt.Errorf("could not read dictionary: %w", err)
+	}
+	d := GetDatabase()
+	// entries are added in the order of their ids, like they were saved,
+	// which have to count up from 0 like Version assumes
+	for i, id := range sortedIDs(f.Values) {
+		if err := checkSeq(ValueEntry, id, "h_", i); err != nil {
+			return Database{}, err
+		}
+		d.add(ValueEntry, id, f.Values[id], nil)
+	}
+	for i, id := range sortedIDs(f.Keys) {
+		if err := checkSeq(KeyEntry, id, "h_", i); err != nil {
+			return Database{}, err
+		}
+		d.add(KeyEntry, id, f.Keys[id], nil)
+	}
+	for i, id := range sortedIDs(f.Shapes) {
+		if err := checkSeq(ShapeEntry, id, "s_", i); err != nil {
+			return Database{}, err
+		}
+		d.add(ShapeEntry, id, "", f.Shapes[id])
+	}
+	d.compressedKeys = d.compressedKeys || f.CompressedKeys
+	return d, nil
+}
+
+// checkSeq checks that id is the i-th id of its kind.
+func checkSeq(kind EntryKind, id, prefix string, i int) error {
+	if want := prefix + strconv.Itoa(i); id != want {
+		return fmt.Errorf("could not read dictionary: got %s %s, want %s", kind, id, want)
+	}
+	return nil
+}
+
+// add adds an entry with the next id of its kind.
+func (d *Database) add(kind EntryKind, id, val string, keys []string) {
+	switch kind {
+	case ValueEntry:
+		d.hashValues[id] = val
+		d.valueIDs[val] = id
+		d.valueList = append(d.valueList, val)
+	case KeyEntry:
+		d.hashKeys[id] = val
+		d.keyIDs[val] = id
+		d.keyList = append(d.keyList, val)
+		d.compressedKeys = true
+	case ShapeEntry:
+		d.shapes[id] = keys
+		d.shapeIDs[shapeKey(keys)] = id
+		d.shapeList = append(d.shapeList, keys)
+	}
+}
+
+// sortedIDs returns the ids of a map by their sequence number.
+func sortedIDs[V any](m map[string]V) []string {
+	ids := make([]string, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return entrySeq(ids[i]) < entrySeq(ids[j]) })
+	return ids
 }
@@ -0,0 +1,118 @@
+package fstore
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDatabaseEntries(t *testing.T) {
+	f := Listener()
+	f.Threshhold = 5
+	f.UseKeyCompression = true
+
+	for _, ua := range []string{"Mozilla/5.0 A", "Mozilla/5.0 B", "Mozilla/5.0 A"} {
+		if _, err := f.Store(map[string]any{"user_agent": ua}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d := f.Database()
+	if d.Len() != 3 {
+		t.Errorf("expected 3 entries, got %d", d.Len())
+	}
+	id, ok := d.IDOf("Mozilla/5.0 A")
+	if !ok {
+		t.Fatal("value not found")
+	}
+	if v, _ := d.Lookup(id); v != "Mozilla/5.0 A" {
+		t.Errorf("lookup of %s returned %q", id, v)
+	}
+
+	e, ok := d.Entry(ValueEntry, id)
+	if !ok || e.Refs != 2 || e.FirstSeen.IsZero() || e.LastSeen.Before(e.FirstSeen) {
+		t.Errorf("unexpected entry %+v", e)
+	}
+	keys := d.Entries(KeyEntry)
+	if len(keys) != 1 || keys[0].Value != "user_agent" || keys[0].Refs != 3 {
+		t.Errorf("unexpected key entries %+v", keys)
+	}
+	values := d.Entries(ValueEntry)
+	if len(values) != 2 || values[0].ID != "h_0" || values[1].Value != "Mozilla/5.0 B" {
+		t.Errorf("unexpected value entries %+v", values)
+	}
+
+	// usage is not part of the dictionary file
+	var buf bytes.Buffer
+	if _, err := d.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadDatabase(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, ok := read.Entry(ValueEntry, id); !ok || e.Refs != 0 || !e.FirstSeen.IsZero() {
+		t.Errorf("unexpected entry after reading %+v", e)
+	}
+}
+
+func TestReadDatabaseGaps(t *testing.T) {
+	for _, dict := range []string{
+		`{"values":{"h_0":"a","h_2":"c"}}`,
+		`{"values":{"h_1":"b"}}`,
+		`{"keys":{"h_0":"a","h_00":"b"}}`,
+		`{"shapes":{"h_0":["a"]}}`,
+	} {
+		if _, err := ReadDatabase(strings.NewReader(dict)); err == nil {
+			t.Errorf("%s: expected an error", dict)
+		}
+	}
+	d, err := ReadDatabase(strings.NewReader(`{"values":{"h_1":"b","h_0":"a"},"shapes":{"s_0":["a"]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Version{Values: 2, Shapes: 1}); d.Version() != want {
+		t.Errorf("got version %v, want %v", d.Version(), want)
+	}
+}
+
+func TestDatabaseTimestamps(t *testing.T) {
+	f := Listener()
+	f.Threshhold = 5
+	f.UseKeyCompression = true
+	data := map[string]any{}
+	for i := 0; i < 50; i++ {
+		data[fmt.Sprintf("key_%d", i)] = fmt.Sprintf("value-%d", i)
+	}
+	if _, err := f.Store(data); err != nil {
+		t.Fatal(err)
+	}
+
+	var first time.Time
+	for _, kind := range []EntryKind{ValueEntry, KeyEntry} {
+		for _, e := range f.Database().Entries(kind) {
+			if first.IsZero() {
+				first = e.FirstSeen
+			}
+			if !e.FirstSeen.Equal(first) || !e.LastSeen.Equal(first) {
+				t.Fatalf("entries of one Store call have different timestamps: %+v", e)
+			}
+		}
+	}
+
+	// refs of struct keys are counted once per stored field
+	type record struct {
+		Name string `json:"name"`
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := f.Store(record{Name: "fingerprint"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	id, _ := f.Database().KeyIDOf("name")
+	if e, _ := f.Database().Entry(KeyEntry, id); e.Refs != 3 || e.LastSeen.Before(first) {
+		t.Errorf("unexpected key entry %+v", e)
+	}
+}
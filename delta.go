@@ -0,0 +1,254 @@
+package fstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// AutoBase lets StoreDelta pick the stored record closest to the data as
+// its base.
+const AutoBase RecordID = -1
+
+// Delta is a record stored as the difference to a base record. The patch
+// is a compacted JSON merge patch (RFC 7396): it contains the changed
+// values, null for removed keys, and arrays are replaced as a whole.
+//
+// As in any merge patch, null cannot be told apart from a removed key:
+// fields that are explicitly null in the data are missing once the delta
+// is restored. Store such records with Put instead.
+type Delta struct {
+	Base  RecordID
+	Patch any
+}
+
+// deltaJSON is the JSON form of a Delta.
+type deltaJSON struct {
+	Base  RecordID `json:"$base"`
+	Patch any      `json:"$patch"`
+}
+
+func (d *Delta) MarshalJSON() ([]byte, error) {
+	return json.Marshal(deltaJSON{Base: d.Base, Patch: d.Patch})
+}
+
+// asDelta recognizes a Delta in data decoded from JSON.
+func asDelta(data any) (*Delta, bool) {
+	if d, ok := data.(*Delta); ok {
+		return d, true
+	}
+	keys, fields, ok := objectFields(data)
+	if !ok || len(keys) != 2 {
+		return nil, false
+	}
+	base, ok := fields["$base"].(float64)
+	if !ok {
+		return nil, false
+	}
+	patch, ok := fields["$patch"]
+	if !ok {
+		return nil, false
+	}
+	return &Delta{Base: RecordID(base), Patch: patch}, true
+}
+
+// StoreDelta compacts data as the difference to the record base. With
+// AutoBase the closest stored record is used, see Nearest. Only the patch
+// goes through the dictionary, and with CollectStats the delta is measured.
+func (s *StoreListener) StoreDelta(base RecordID, data any) (*Delta, error) {
+	before := s.database.counters
+	w := s.worker()
+	res, err := w.store(data)
+	if err != nil {
+		return nil, err
+	}
+	if base == AutoBase {
+		probe, err := s.lookup(w, res)
+		if err != nil {
+			return nil, err
+		}
+		if base, err = s.Nearest(probe); err != nil {
+			return nil, err
+		}
+	}
+	// restoring drops empty values the same way for both sides
+	target, err := w.Restore(res)
+	if err != nil {
+		return nil, err
+	}
+	d, err := s.deltaTo(base, target)
+	if err != nil {
+		return nil, err
+	}
+	if s.CollectStats {
+		s.collect(data, d, before)
+	}
+	return d, nil
+}
+
+// deltaTo builds the delta of target, restored data, to the record base.
+func (s *StoreListener) deltaTo(base RecordID, target any) (*Delta, error) {
+	baseData, err := s.Get(base)
+	if err != nil {
+		return nil, err
+	}
+
+	defer s.database.begin()()
+	patch, err := s.getFieldValue(reflect.ValueOf(mergeDiff(baseData, target)), false, "")
+	if err != nil {
+		return nil, err
+	}
+	return &Delta{Base: base, Patch: patch}, nil
+}
+
+// PutDelta works like StoreDelta, but keeps the delta as a record.
+func (s *StoreListener) PutDelta(base RecordID, data any) (RecordID, error) {
+	d, err := s.StoreDelta(base, data)
+	if err != nil {
+		return 0, err
+	}
+	return s.addRecord(d)
+}
+
+func (s *StoreListener) restoreDelta(d *Delta) (any, error) {
+	base, err := s.Get(d.Base)
+	if err != nil {
+		return nil, fmt.Errorf("could not restore delta: %w", err)
+	}
+	patch, err := s.Restore(d.Patch)
+	if err != nil {
+		return nil, err
+	}
+	return mergePatch(base, patch), nil
+}
+
+// Nearest returns the stored full record (not a delta) closest to res,
+// compacted data, by the number of differing values.
+func (s *StoreListener) Nearest(res any) (RecordID, error) {
+	target := s.leaves(res)
+	best, bestDist := AutoBase, -1
+	for _, id := range s.RecordIDs() {
+		rec := s.records.records[id]
+		if _, ok := rec.(*Delta); ok {
+			continue
+		}
+		if d := distance(target, s.leaves(rec)); bestDist < 0 || d < bestDist {
+			best, bestDist = id, d
+		}
+	}
+	if best == AutoBase {
+		return 0, errors.New("no record to use as base")
+	}
+	return best, nil
+}
+
+// distance counts the paths that are missing on one side or differ.
+func distance(a, b map[string]any) int {
+	d := 0
+	for k, v := range a {
+		if w, ok := b[k]; !ok || !reflect.DeepEqual(v, w) {
+			d++
+		}
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			d++
+		}
+	}
+	return d
+}
+
+// objectFields returns the keys (in order) and values of an object, either
+// an *Object or a map, whose keys are sorted.
+func objectFields(data any) ([]string, map[string]any, bool) {
+	switch v := data.(type) {
+	case *Object:
+		return v.Keys, v.Values, true
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return keys, v, true
+	}
+	return nil, nil, false
+}
+
+// mergeDiff returns the JSON merge patch turning base into target.
+func mergeDiff(base, target any) any {
+	baseKeys, baseFields, ok := objectFields(base)
+	targetKeys, targetFields, ok2 := objectFields(target)
+	if !ok || !ok2 {
+		return target
+	}
+
+	patch := NewObject()
+	for _, k := range targetKeys {
+		t := targetFields[k]
+		b, exists := baseFields[k]
+		switch {
+		case !exists:
+			patch.Set(k, t)
+		case !reflect.DeepEqual(normalize(b), normalize(t)):
+			patch.Set(k, mergeDiff(b, t))
+		}
+	}
+	for _, k := range baseKeys {
+		if _, ok := targetFields[k]; !ok {
+			patch.Set(k, nil)
+		}
+	}
+	return patch
+}
+
+// normalize turns objects into maps, so values can be compared regardless
+// of their key order.
+func normalize(v any) any {
+	if keys, fields, ok := objectFields(v); ok {
+		m := make(map[string]any, len(keys))
+		for _, k := range keys {
+			m[k] = normalize(fields[k])
+		}
+		return m
+	}
+	if arr, ok := v.([]any); ok {
+		res := make([]any, len(arr))
+		for i, e := range arr {
+			res[i] = normalize(e)
+		}
+		return res
+	}
+	return v
+}
+
+// mergePatch applies a JSON merge patch to base.
+func mergePatch(base, patch any) any {
+	patchKeys, patchFields, ok := objectFields(patch)
+	if !ok {
+		return patch
+	}
+
+	result := NewObject()
+	if keys, fields, ok := objectFields(base); ok {
+		for _, k := range keys {
+			result.Set(k, fields[k])
+		}
+	}
+	for _, k := range patchKeys {
+		v := patchFields[k]
+		if v == nil {
+			result.remove(k)
+			continue
+		}
+		old, _ := result.Get(k)
+		result.Set(k, mergePatch(old, v))
+	}
+
+	if _, ok := base.(map[string]any); ok {
+		return result.Values
+	}
+	return result
+}
@@ -0,0 +1,183 @@
+package fstore
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDelta(t *testing.T) {
+	decode := func() map[string]any {
+		var data map[string]any
+		if err := json.Unmarshal(fp2, &data); err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	f := Listener()
+	f.Threshhold = 5
+	f.UseKeyCompression = true
+
+	other := decode()
+	other["userAgent"] = "curl/8.1.2"
+	other["platform"] = "Linux x86_64"
+	other["language"] = "de-DE"
+	if _, err := f.Put(other); err != nil {
+		t.Fatal(err)
+	}
+	base, err := f.Put(decode())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := decode()
+	data["userAgent"] = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7)"
+	data["hardwareConcurrency"] = 16.0
+	delete(data, "vendor")
+	data["screen"].(map[string]any)["width"] = 2560.0
+
+	d, err := f.StoreDelta(AutoBase, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Base != base {
+		t.Errorf("expected record %d as base, got %d", base, d.Base)
+	}
+
+	patch, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	full, _ := f.Store(data)
+	fullJSON, _ := json.Marshal(full)
+	if len(patch) > len(fullJSON)/10 {
+		t.Errorf("delta is not much smaller than the record: %d vs %d bytes\n%s", len(patch), len(fullJSON), patch)
+	}
+
+	var stored any
+	if err := json.Unmarshal(patch, &stored); err != nil {
+		t.Fatal(err)
+	}
+	got, err := f.Restore(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := f.Restore(full)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(normalize(got), normalize(want)) {
+		t.Error("restored delta differs from the data")
+	}
+
+	id, err := f.PutDelta(base, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := f.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(normalize(rec), normalize(want)) {
+		t.Error("restored delta record differs from the data")
+	}
+	if err := f.Delete(base); err == nil {
+		t.Error("expected deleting a base record to fail")
+	}
+	if err := f.Delete(id); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Delete(base); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeltaNull(t *testing.T) {
+	f := Listener()
+	f.Threshhold = 5
+	base, err := f.Put(map[string]any{"name": "fingerprint", "vendor": "Google Inc."})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// explicit nulls are not supported, they read as removed keys
+	id, err := f.PutDelta(base, map[string]any{"name": "fingerprint", "vendor": nil, "extra": nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := f.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]any{"name": "fingerprint"}; !reflect.DeepEqual(normalize(got), want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestDeltaReadOnly(t *testing.T) {
+	for _, shapes := range []bool{false, true} {
+		f := Listener()
+		f.Threshhold = 5
+		f.UseKeyCompression = true
+		f.UseShapes = shapes
+		base, err := f.Put(map[string]any{"name": "fingerprint", "screen": map[string]any{"width": 1920.0}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.PutDelta(base, map[string]any{"name": "fingerprint", "screen": map[string]any{"width": 2560.0, "depth": 24.0}, "vendor": "Google Inc."}); err != nil {
+			t.Fatal(err)
+		}
+
+		refs := func() map[string]int {
+			m := map[string]int{}
+			for _, kind := range []EntryKind{ValueEntry, KeyEntry, ShapeEntry} {
+				for _, e := range f.Database().Entries(kind) {
+					m[kind.String()+e.ID] = e.Refs
+				}
+			}
+			return m
+		}
+		before, version := refs(), f.Database().Version()
+		got, err := f.Query(Eq("vendor", "Google Inc."), Eq("screen.width", 2560))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 || got[0] != base+1 {
+			t.Errorf("shapes %v: query found %v", shapes, got)
+		}
+		if err := f.AddIndex("screen.depth"); err != nil {
+			t.Fatal(err)
+		}
+		if f.Database().Version() != version || !reflect.DeepEqual(refs(), before) {
+			t.Errorf("shapes %v: reading deltas changed the dictionary", shapes)
+		}
+	}
+}
+
+func TestDeltaUsage(t *testing.T) {
+	f := Listener()
+	f.Threshhold = 5
+	base, err := f.Put(map[string]any{"name": "fingerprint", "vendor": "Google Inc."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.CollectStats = true
+
+	d, err := f.StoreDelta(base, map[string]any{"name": "fingerprint", "vendor": "Apple Computer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs := func(val string) int {
+		id, _ := f.Database().IDOf(val)
+		e, _ := f.Database().Entry(ValueEntry, id)
+		return e.Refs
+	}
+	if refs("fingerprint") != 1 || refs("Apple Computer") != 1 {
+		t.Errorf("expected only the patch to be counted, got %d and %d refs", refs("fingerprint"), refs("Apple Computer"))
+	}
+	patch, _ := json.Marshal(d)
+	if st := f.Stats(); st.Calls != 1 || st.OutputBytes != len(patch) || st.References != 1 {
+		t.Errorf("expected the delta to be measured, got %v", st)
+	}
+}
@@ -0,0 +1,23 @@
+package fstore
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// FallbackEncoder converts a value the walker cannot compact (channels,
+// funcs, complex numbers, ...) into something it can store. The returned
+// value is stored as is. Unexported fields are skipped before that.
+// StoreBatchParallel calls it from several goroutines at once.
+type FallbackEncoder func(path string, v reflect.Value) (any, error)
+
+// UnsupportedError is returned in strict mode when Store runs into a value
+// it cannot compact.
+type UnsupportedError struct {
+	Path string
+	Kind reflect.Kind
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("could not store value of kind %s at %q", e.Kind, e.Path)
+}
@@ -0,0 +1,295 @@
+// Code generated by fstoregen. DO NOT EDIT.
+
+package fstore
+
+// CompactExampleStruct compacts v like StoreListener.Store would, without reflection.
+func CompactExampleStruct(s *StoreListener, v *ExampleStruct) (any, error) {
+	m1 := s.NewFieldSet()
+	m1.Set("ip", s.CompactString("ip", "ip", (*v).IP))
+	m1.Set("http_version", s.CompactString("http_version", "http_version", (*v).HTTPVersion))
+	m1.Set("method", s.CompactString("method", "method", (*v).Method))
+	m1.Set("user_agent", s.CompactString("user_agent", "user_agent", (*v).UserAgent))
+	m2 := s.NewFieldSet()
+	a3 := make([]any, 0, len((*v).TLS.Ciphers))
+	for i4 := range (*v).TLS.Ciphers {
+		a3 = append(a3, s.CompactString("", "tls.ciphers[]", (*v).TLS.Ciphers[i4]))
+	}
+	m2.Set("ciphers", a3)
+	a5 := make([]any, 0, len((*v).TLS.Extensions))
+	for i6 := range (*v).TLS.Extensions {
+		m7 := s.NewFieldSet()
+		m7.Set("name", s.CompactString("name", "tls.extensions[].name", (*v).TLS.Extensions[i6].Name))
+		m7.Set("data", s.CompactString("data", "tls.extensions[].data", (*v).TLS.Extensions[i6].Data))
+		a8 := make([]any, 0, len((*v).TLS.Extensions[i6].SupportedGroups))
+		for i9 := range (*v).TLS.Extensions[i6].SupportedGroups {
+			a8 = append(a8, s.CompactString("", "tls.extensions[].supported_groups[]", (*v).TLS.Extensions[i6].SupportedGroups[i9]))
+		}
+		m7.Set("supported_groups", a8)
+		m7.Set("master_secret_data", s.CompactString("master_secret_data", "tls.extensions[].master_secret_data", (*v).TLS.Extensions[i6].MasterSecretData))
+		m7.Set("extended_master_secret_data", s.CompactString("extended_master_secret_data", "tls.extensions[].extended_master_secret_data", (*v).TLS.Extensions[i6].ExtendedMasterSecretData))
+		a10 := make([]any, 0, len((*v).TLS.Extensions[i6].SignatureAlgorithms))
+		for i11 := range (*v).TLS.Extensions[i6].SignatureAlgorithms {
+			a10 = append(a10, s.CompactString("", "tls.extensions[].signature_algorithms[]", (*v).TLS.Extensions[i6].SignatureAlgorithms[i11]))
+		}
+		m7.Set("signature_algorithms", a10)
+		m12 := s.NewFieldSet()
+		m12.Set("certificate_status_type", s.CompactString("certificate_status_type", "tls.extensions[].status_request.certificate_status_type", (*v).TLS.Extensions[i6].StatusRequest.CertificateStatusType))
+		m12.Set("responder_id_list_length", int64((*v).TLS.Extensions[i6].StatusRequest.ResponderIDListLength))
+		m12.Set("request_extensions_length", int64((*v).TLS.Extensions[i6].StatusRequest.RequestExtensionsLength))
+		m7.Set("status_request", m12.Value())
+		a13 := make([]any, 0, len((*v).TLS.Extensions[i6].Versions))
+		for i14 := range (*v).TLS.Extensions[i6].Versions {
+			a13 = append(a13, s.CompactString("", "tls.extensions[].versions[]", (*v).TLS.Extensions[i6].Versions[i14]))
+		}
+		m7.Set("versions", a13)
+		a15 := make([]any, 0, len((*v).TLS.Extensions[i6].Algorithms))
+		for i16 := range (*v).TLS.Extensions[i6].Algorithms {
+			a15 = append(a15, s.CompactString("", "tls.extensions[].algorithms[]", (*v).TLS.Extensions[i6].Algorithms[i16]))
+		}
+		m7.Set("algorithms", a15)
+		m7.Set("server_name", s.CompactString("server_name", "tls.extensions[].server_name", (*v).TLS.Extensions[i6].ServerName))
+		a17 := make([]any, 0, len((*v).TLS.Extensions[i6].SharedKeys))
+		for i18 := range (*v).TLS.Extensions[i6].SharedKeys {
+			m19 := s.NewFieldSet()
+			m19.Set("TLS_GREASE (0xfafa)", s.CompactString("TLS_GREASE (0xfafa)", "tls.extensions[].shared_keys[].TLS_GREASE (0xfafa)", (*v).TLS.Extensions[i6].SharedKeys[i18].TLSGREASE0Xfafa))
+			m19.Set("X25519Kyber768 (25497)", s.CompactString("X25519Kyber768 (25497)", "tls.extensions[].shared_keys[].X25519Kyber768 (25497)", (*v).TLS.Extensions[i6].SharedKeys[i18].X25519Kyber76825497))
+			m19.Set("X25519 (29)", s.CompactString("X25519 (29)", "tls.extensions[].shared_keys[].X25519 (29)", (*v).TLS.Extensions[i6].SharedKeys[i18].X2551929))
+			a17 = append(a17, m19.Value())
+		}
+		m7.Set("shared_keys", a17)
+		a20 := make([]any, 0, len((*v).TLS.Extensions[i6].EllipticCurvesPointFormats))
+		for i21 := range (*v).TLS.Extensions[i6].EllipticCurvesPointFormats {
+			a20 = append(a20, s.CompactString("", "tls.extensions[].elliptic_curves_point_formats[]", (*v).TLS.Extensions[i6].EllipticCurvesPointFormats[i21]))
+		}
+		m7.Set("elliptic_curves_point_formats", a20)
+		a22 := make([]any, 0, len((*v).TLS.Extensions[i6].Protocols))
+		for i23 := range (*v).TLS.Extensions[i6].Protocols {
+			a22 = append(a22, s.CompactString("", "tls.extensions[].protocols[]", (*v).TLS.Extensions[i6].Protocols[i23]))
+		}
+		m7.Set("protocols", a22)
+		m7.Set("PSK_Key_Exchange_Mode", s.CompactString("PSK_Key_Exchange_Mode", "tls.extensions[].PSK_Key_Exchange_Mode", (*v).TLS.Extensions[i6].PSKKeyExchangeMode))
+		a5 = append(a5, m7.Value())
+	}
+	m2.Set("extensions", a5)
+	m2.Set("tls_version_record", s.CompactString("tls_version_record", "tls.tls_version_record", (*v).TLS.TLSVersionRecord))
+	m2.Set("tls_version_negotiated", s.CompactString("tls_version_negotiated", "tls.tls_version_negotiated", (*v).TLS.TLSVersionNegotiated))
+	m2.Set("ja3", s.CompactString("ja3", "tls.ja3", (*v).TLS.Ja3))
+	m2.Set("ja3_hash", s.CompactString("ja3_hash", "tls.ja3_hash", (*v).TLS.Ja3Hash))
+	m2.Set("peetprint", s.CompactString("peetprint", "tls.peetprint", (*v).TLS.Peetprint))
+	m2.Set("peetprint_hash", s.CompactString("peetprint_hash", "tls.peetprint_hash", (*v).TLS.PeetprintHash))
+	m2.Set("client_random", s.CompactString("client_random", "tls.client_random", (*v).TLS.ClientRandom))
+	m2.Set("session_id", s.CompactString("session_id", "tls.session_id", (*v).TLS.SessionID))
+	m1.Set("tls", m2.Value())
+	m24 := s.NewFieldSet()
+	m24.Set("akamai_fingerprint", s.CompactString("akamai_fingerprint", "http2.akamai_fingerprint", (*v).HTTP2.AkamaiFingerprint))
+	m24.Set("akamai_fingerprint_hash", s.CompactString("akamai_fingerprint_hash", "http2.akamai_fingerprint_hash", (*v).HTTP2.AkamaiFingerprintHash))
+	a25 := make([]any, 0, len((*v).HTTP2.SentFrames))
+	for i26 := range (*v).HTTP2.SentFrames {
+		m27 := s.NewFieldSet()
+		m27.Set("frame_type", s.CompactString("frame_type", "http2.sent_frames[].frame_type", (*v).HTTP2.SentFrames[i26].FrameType))
+		m27.Set("length", int64((*v).HTTP2.SentFrames[i26].Length))
+		a28 := make([]any, 0, len((*v).HTTP2.SentFrames[i26].Settings))
+		for i29 := range (*v).HTTP2.SentFrames[i26].Settings {
+			a28 = append(a28, s.CompactString("", "http2.sent_frames[].settings[]", (*v).HTTP2.SentFrames[i26].Settings[i29]))
+		}
+		m27.Set("settings", a28)
+		m27.Set("increment", int64((*v).HTTP2.SentFrames[i26].Increment))
+		m27.Set("stream_id", int64((*v).HTTP2.SentFrames[i26].StreamID))
+		a30 := make([]any, 0, len((*v).HTTP2.SentFrames[i26].Headers))
+		for i31 := range (*v).HTTP2.SentFrames[i26].Headers {
+			a30 = append(a30, s.CompactString("", "http2.sent_frames[].headers[]", (*v).HTTP2.SentFrames[i26].Headers[i31]))
+		}
+		m27.Set("headers", a30)
+		a32 := make([]any, 0, len((*v).HTTP2.SentFrames[i26].Flags))
+		for i33 := range (*v).HTTP2.SentFrames[i26].Flags {
+			a32 = append(a32, s.CompactString("", "http2.sent_frames[].flags[]", (*v).HTTP2.SentFrames[i26].Flags[i33]))
+		}
+		m27.Set("flags", a32)
+		m34 := s.NewFieldSet()
+		m34.Set("weight", int64((*v).HTTP2.SentFrames[i26].Priority.Weight))
+		m34.Set("depends_on", int64((*v).HTTP2.SentFrames[i26].Priority.DependsOn))
+		m34.Set("exclusive", int64((*v).HTTP2.SentFrames[i26].Priority.Exclusive))
+		m27.Set("priority", m34.Value())
+		a25 = append(a25, m27.Value())
+	}
+	m24.Set("sent_frames", a25)
+	m1.Set("http2", m24.Value())
+	return m1.Value(), nil
+}
+
+// RestoreExampleStruct restores data, a result of CompactExampleStruct or Store, into v.
+func RestoreExampleStruct(s *StoreListener, data any, v *ExampleStruct) error {
+	r, err := s.Restore(data)
+	if err != nil {
+		return err
+	}
+	return decodeExampleStruct(s, r, v)
+}
+
+func decodeExampleStruct(s *StoreListener, data any, v *ExampleStruct) error {
+	if m35, ok := RestoredFields(data); ok {
+		(*v).IP = RestoredString(m35["ip"])
+		(*v).HTTPVersion = RestoredString(m35["http_version"])
+		(*v).Method = RestoredString(m35["method"])
+		(*v).UserAgent = RestoredString(m35["user_agent"])
+		if m36, ok := RestoredFields(m35["tls"]); ok {
+			if a37, ok := m36["ciphers"].([]any); ok {
+				(*v).TLS.Ciphers = make([]string, len(a37))
+				for i38, e39 := range a37 {
+					(*v).TLS.Ciphers[i38] = RestoredString(e39)
+				}
+			}
+			if a40, ok := m36["extensions"].([]any); ok {
+				(*v).TLS.Extensions = make([]struct {
+					Name                     string   `json:"name"`
+					Data                     string   `json:"data,omitempty"`
+					SupportedGroups          []string `json:"supported_groups,omitempty"`
+					MasterSecretData         string   `json:"master_secret_data,omitempty"`
+					ExtendedMasterSecretData string   `json:"extended_master_secret_data,omitempty"`
+					SignatureAlgorithms      []string `json:"signature_algorithms,omitempty"`
+					StatusRequest            struct {
+						CertificateStatusType   string `json:"certificate_status_type"`
+						ResponderIDListLength   int    `json:"responder_id_list_length"`
+						RequestExtensionsLength int    `json:"request_extensions_length"`
+					} `json:"status_request,omitempty"`
+					Versions   []string `json:"versions,omitempty"`
+					Algorithms []string `json:"algorithms,omitempty"`
+					ServerName string   `json:"server_name,omitempty"`
+					SharedKeys []struct {
+						TLSGREASE0Xfafa     string `json:"TLS_GREASE (0xfafa),omitempty"`
+						X25519Kyber76825497 string `json:"X25519Kyber768 (25497),omitempty"`
+						X2551929            string `json:"X25519 (29),omitempty"`
+					} `json:"shared_keys,omitempty"`
+					EllipticCurvesPointFormats []string `json:"elliptic_curves_point_formats,omitempty"`
+					Protocols                  []string `json:"protocols,omitempty"`
+					PSKKeyExchangeMode         string   `json:"PSK_Key_Exchange_Mode,omitempty"`
+				}, len(a40))
+				for i41, e42 := range a40 {
+					if m43, ok := RestoredFields(e42); ok {
+						(*v).TLS.Extensions[i41].Name = RestoredString(m43["name"])
+						(*v).TLS.Extensions[i41].Data = RestoredString(m43["data"])
+						if a44, ok := m43["supported_groups"].([]any); ok {
+							(*v).TLS.Extensions[i41].SupportedGroups = make([]string, len(a44))
+							for i45, e46 := range a44 {
+								(*v).TLS.Extensions[i41].SupportedGroups[i45] = RestoredString(e46)
+							}
+						}
+						(*v).TLS.Extensions[i41].MasterSecretData = RestoredString(m43["master_secret_data"])
+						(*v).TLS.Extensions[i41].ExtendedMasterSecretData = RestoredString(m43["extended_master_secret_data"])
+						if a47, ok := m43["signature_algorithms"].([]any); ok {
+							(*v).TLS.Extensions[i41].SignatureAlgorithms = make([]string, len(a47))
+							for i48, e49 := range a47 {
+								(*v).TLS.Extensions[i41].SignatureAlgorithms[i48] = RestoredString(e49)
+							}
+						}
+						if m50, ok := RestoredFields(m43["status_request"]); ok {
+							(*v).TLS.Extensions[i41].StatusRequest.CertificateStatusType = RestoredString(m50["certificate_status_type"])
+							(*v).TLS.Extensions[i41].StatusRequest.ResponderIDListLength = int(RestoredInt(m50["responder_id_list_length"]))
+							(*v).TLS.Extensions[i41].StatusRequest.RequestExtensionsLength = int(RestoredInt(m50["request_extensions_length"]))
+						}
+						if a51, ok := m43["versions"].([]any); ok {
+							(*v).TLS.Extensions[i41].Versions = make([]string, len(a51))
+							for i52, e53 := range a51 {
+								(*v).TLS.Extensions[i41].Versions[i52] = RestoredString(e53)
+							}
+						}
+						if a54, ok := m43["algorithms"].([]any); ok {
+							(*v).TLS.Extensions[i41].Algorithms = make([]string, len(a54))
+							for i55, e56 := range a54 {
+								(*v).TLS.Extensions[i41].Algorithms[i55] = RestoredString(e56)
+							}
+						}
+						(*v).TLS.Extensions[i41].ServerName = RestoredString(m43["server_name"])
+						if a57, ok := m43["shared_keys"].([]any); ok {
+							(*v).TLS.Extensions[i41].SharedKeys = make([]struct {
+								TLSGREASE0Xfafa     string `json:"TLS_GREASE (0xfafa),omitempty"`
+								X25519Kyber76825497 string `json:"X25519Kyber768 (25497),omitempty"`
+								X2551929            string `json:"X25519 (29),omitempty"`
+							}, len(a57))
+							for i58, e59 := range a57 {
+								if m60, ok := RestoredFields(e59); ok {
+									(*v).TLS.Extensions[i41].SharedKeys[i58].TLSGREASE0Xfafa = RestoredString(m60["TLS_GREASE (0xfafa)"])
+									(*v).TLS.Extensions[i41].SharedKeys[i58].X25519Kyber76825497 = RestoredString(m60["X25519Kyber768 (25497)"])
+									(*v).TLS.Extensions[i41].SharedKeys[i58].X2551929 = RestoredString(m60["X25519 (29)"])
+								}
+							}
+						}
+						if a61, ok := m43["elliptic_curves_point_formats"].([]any); ok {
+							(*v).TLS.Extensions[i41].EllipticCurvesPointFormats = make([]string, len(a61))
+							for i62, e63 := range a61 {
+								(*v).TLS.Extensions[i41].EllipticCurvesPointFormats[i62] = RestoredString(e63)
+							}
+						}
+						if a64, ok := m43["protocols"].([]any); ok {
+							(*v).TLS.Extensions[i41].Protocols = make([]string, len(a64))
+							for i65, e66 := range a64 {
+								(*v).TLS.Extensions[i41].Protocols[i65] = RestoredString(e66)
+							}
+						}
+						(*v).TLS.Extensions[i41].PSKKeyExchangeMode = RestoredString(m43["PSK_Key_Exchange_Mode"])
+					}
+				}
+			}
+			(*v).TLS.TLSVersionRecord = RestoredString(m36["tls_version_record"])
+			(*v).TLS.TLSVersionNegotiated = RestoredString(m36["tls_version_negotiated"])
+			(*v).TLS.Ja3 = RestoredString(m36["ja3"])
+			(*v).TLS.Ja3Hash = RestoredString(m36["ja3_hash"])
+			(*v).TLS.Peetprint = RestoredString(m36["peetprint"])
+			(*v).TLS.PeetprintHash = RestoredString(m36["peetprint_hash"])
+			(*v).TLS.ClientRandom = RestoredString(m36["client_random"])
+			(*v).TLS.SessionID = RestoredString(m36["session_id"])
+		}
+		if m67, ok := RestoredFields(m35["http2"]); ok {
+			(*v).HTTP2.AkamaiFingerprint = RestoredString(m67["akamai_fingerprint"])
+			(*v).HTTP2.AkamaiFingerprintHash = RestoredString(m67["akamai_fingerprint_hash"])
+			if a68, ok := m67["sent_frames"].([]any); ok {
+				(*v).HTTP2.SentFrames = make([]struct {
+					FrameType string   `json:"frame_type"`
+					Length    int      `json:"length"`
+					Settings  []string `json:"settings,omitempty"`
+					Increment int      `json:"increment,omitempty"`
+					StreamID  int      `json:"stream_id,omitempty"`
+					Headers   []string `json:"headers,omitempty"`
+					Flags     []string `json:"flags,omitempty"`
+					Priority  struct {
+						Weight    int `json:"weight"`
+						DependsOn int `json:"depends_on"`
+						Exclusive int `json:"exclusive"`
+					} `json:"priority,omitempty"`
+				}, len(a68))
+				for i69, e70 := range a68 {
+					if m71, ok := RestoredFields(e70); ok {
+						(*v).HTTP2.SentFrames[i69].FrameType = RestoredString(m71["frame_type"])
+						(*v).HTTP2.SentFrames[i69].Length = int(RestoredInt(m71["length"]))
+						if a72, ok := m71["settings"].([]any); ok {
+							(*v).HTTP2.SentFrames[i69].Settings = make([]string, len(a72))
+							for i73, e74 := range a72 {
+								(*v).HTTP2.SentFrames[i69].Settings[i73] = RestoredString(e74)
+							}
+						}
+						(*v).HTTP2.SentFrames[i69].Increment = int(RestoredInt(m71["increment"]))
+						(*v).HTTP2.SentFrames[i69].StreamID = int(RestoredInt(m71["stream_id"]))
+						if a75, ok := m71["headers"].([]any); ok {
+							(*v).HTTP2.SentFrames[i69].Headers = make([]string, len(a75))
+							for i76, e77 := range a75 {
+								(*v).HTTP2.SentFrames[i69].Headers[i76] = RestoredString(e77)
+							}
+						}
+						if a78, ok := m71["flags"].([]any); ok {
+							(*v).HTTP2.SentFrames[i69].Flags = make([]string, len(a78))
+							for i79, e80 := range a78 {
+								(*v).HTTP2.SentFrames[i69].Flags[i79] = RestoredString(e80)
+							}
+						}
+						if m81, ok := RestoredFields(m71["priority"]); ok {
+							(*v).HTTP2.SentFrames[i69].Priority.Weight = int(RestoredInt(m81["weight"]))
+							(*v).HTTP2.SentFrames[i69].Priority.DependsOn = int(RestoredInt(m81["depends_on"]))
+							(*v).HTTP2.SentFrames[i69].Priority.Exclusive = int(RestoredInt(m81["exclusive"]))
+						}
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package fstore
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FacetCount is the number of records that have a value at a path.
+type FacetCount struct {
+	Value any
+	Count int
+}
+
+// Facet counts the records per value at path, like "tls_version_negotiated"
+// or "fonts[*]", most frequent first. A record is counted once per value.
+// Records are counted by their compacted values, only the values in the
+// result are restored. Indexed paths are counted from the index, see
+// AddIndex.
+func (s *StoreListener) Facet(path string) ([]FacetCount, error) {
+	counts := map[string]int{}
+	if idx, ok := s.indexes[path]; ok {
+		for key, bm := range idx.values {
+			counts[key] = bm.Len()
+		}
+	} else {
+		p := compiledPredicate{Predicate: Predicate{Path: path}, wildcard: strings.Contains(path, "[*]")}
+		for _, id := range s.RecordIDs() {
+			rec, err := s.compactedFull(s.records.records[id])
+			if err != nil {
+				return nil, fmt.Errorf("record %d: %w", id, err)
+			}
+			seen := map[string]bool{}
+			s.walkLeaves(rec, "", func(leaf string, v any) {
+				if key := indexKey(v); p.matchesPath(leaf) && !seen[key] {
+					seen[key] = true
+					counts[key]++
+				}
+			})
+		}
+	}
+
+	result := make([]FacetCount, 0, len(counts))
+	for key, n := range counts {
+		v, err := s.Restore(fromIndexKey(key))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, FacetCount{Value: v, Count: n})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		a, ok := toFloat(result[i].Value)
+		b, ok2 := toFloat(result[j].Value)
+		if ok && ok2 {
+			return a < b
+		}
+		return fmt.Sprint(result[i].Value) < fmt.Sprint(result[j].Value)
+	})
+	return result, nil
+}
+
+// fromIndexKey returns the compacted value behind an index key. Strings
+// keep their escaping, so Restore tells literals and ids apart.
+func fromIndexKey(key string) any {
+	kind, val, _ := strings.Cut(key, ":")
+	switch kind {
+	case "s":
+		return val
+	case "n":
+		f, _ := strconv.ParseFloat(val, 64)
+		return f
+	case "b":
+		return val == "true"
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package fstore
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFacet(t *testing.T) {
+	f := queryListener(t)
+
+	tests := []struct {
+		path  string
+		index bool
+		want  []FacetCount
+	}{
+		{"HighEntropyValues.platform", false, []FacetCount{{"macOS", 3}, {"Windows", 1}}},
+		{"tls.ja3_hash", false, []FacetCount{{"aaa111aaa111", 3}, {"bbb222bbb222", 1}}},
+		{"tls.ja3_hash", true, []FacetCount{{"aaa111aaa111", 3}, {"bbb222bbb222", 1}}},
+		{"languages[*]", false, []FacetCount{{"de-DE", 1}, {"en-US", 1}, {"fr-FR", 1}}},
+		{"hardwareConcurrency", true, []FacetCount{{4.0, 1}, {8.0, 1}, {12.0, 1}, {16.0, 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if tt.index {
+				if err := f.AddIndex(tt.path); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := f.Facet(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
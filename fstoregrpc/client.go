@@ -0,0 +1,163 @@
+package fstoregrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	fstore "fStore"
+	"fStore/fstorepb"
+
+	"google.golang.org/grpc"
+)
+
+// Client wraps the generated client with methods taking and returning the
+// types of package fstore.
+type Client struct {
+	c fstorepb.FStoreClient
+}
+
+func NewClient(cc grpc.ClientConnInterface) *Client {
+	return &Client{c: fstorepb.NewFStoreClient(cc)}
+}
+
+// Put stores data, encoded as JSON, and returns its record id.
+func (c *Client) Put(ctx context.Context, data any) (fstore.RecordID, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.c.Put(ctx, &fstorepb.PutRequest{Json: b})
+	if err != nil {
+		return 0, err
+	}
+	return fstore.RecordID(resp.GetId()), nil
+}
+
+// IngestResult is the outcome of a record sent by Ingest.
+type IngestResult struct {
+	ID  fstore.RecordID
+	Err error
+}
+
+// Ingest streams records to the server. The results match the records by
+// index, records that could not be stored have Err set.
+func (c *Client) Ingest(ctx context.Context, records []any) ([]IngestResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := c.c.Ingest(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sendErr := make(chan error, 1)
+	go func() {
+		err := func() error {
+			for _, r := range records {
+				b, err := json.Marshal(r)
+				if err != nil {
+					return err
+				}
+				if err := stream.Send(&fstorepb.PutRequest{Json: b}); err != nil {
+					return err
+				}
+			}
+			return stream.CloseSend()
+		}()
+		if err != nil {
+			// the server waits for more records otherwise
+			cancel()
+		}
+		sendErr <- err
+	}()
+
+	results := make([]IngestResult, 0, len(records))
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			if serr := <-sendErr; serr != nil {
+				return results, serr
+			}
+			return results, err
+		}
+		if resp.GetError() != "" {
+			results = append(results, IngestResult{Err: errors.New(resp.GetError())})
+			continue
+		}
+		results = append(results, IngestResult{ID: fstore.RecordID(resp.GetId())})
+	}
+	return results, <-sendErr
+}
+
+// Get returns a restored record. Objects keep their key order, see
+// fstore.DecodeJSON.
+func (c *Client) Get(ctx context.Context, id fstore.RecordID) (any, error) {
+	resp, err := c.c.Get(ctx, &fstorepb.GetRequest{Id: int64(id)})
+	if err != nil {
+		return nil, err
+	}
+	return fstore.DecodeJSON(resp.GetJson())
+}
+
+// GetCompacted returns a record as it is stored, see FromValue.
+func (c *Client) GetCompacted(ctx context.Context, id fstore.RecordID) (any, error) {
+	v, err := c.c.GetCompacted(ctx, &fstorepb.GetRequest{Id: int64(id)})
+	if err != nil {
+		return nil, err
+	}
+	return FromValue(v)
+}
+
+// Lookup returns a dictionary entry.
+func (c *Client) Lookup(ctx context.Context, kind fstore.EntryKind, id string) (fstore.Entry, error) {
+	e, err := c.c.Lookup(ctx, &fstorepb.LookupRequest{Kind: fstorepb.EntryKind(kind), Id: id})
+	if err != nil {
+		return fstore.Entry{}, err
+	}
+	return fromEntry(e), nil
+}
+
+// Fetcher returns a fstore.Fetcher syncing a fstore.Replica over this
+// client.
+func (c *Client) Fetcher(ctx context.Context) fstore.Fetcher {
+	return func(since fstore.Version) ([]fstore.Entry, error) {
+		resp, err := c.c.Sync(ctx, &fstorepb.SyncRequest{Since: &fstorepb.Version{
+			Values: int64(since.Values),
+			Keys:   int64(since.Keys),
+			Shapes: int64(since.Shapes),
+		}})
+		if err != nil {
+			return nil, err
+		}
+		entries := make([]fstore.Entry, len(resp.GetEntries()))
+		for i, e := range resp.GetEntries() {
+			entries[i] = fromEntry(e)
+		}
+		return entries, nil
+	}
+}
+
+func fromEntry(e *fstorepb.Entry) fstore.Entry {
+	entry := fstore.Entry{
+		Kind:  fstore.EntryKind(e.GetKind()),
+		ID:    e.GetId(),
+		Value: e.GetValue(),
+		Keys:  e.GetKeys(),
+		Refs:  int(e.GetRefs()),
+	}
+	if e.GetFirstSeen() != 0 {
+		entry.FirstSeen = time.Unix(0, e.GetFirstSeen())
+		entry.LastSeen = time.Unix(0, e.GetLastSeen())
+	}
+	return entry
+}
+
+// Stats returns the server's stats.
+func (c *Client) Stats(ctx context.Context) (*fstorepb.StatsResponse, error) {
+	return c.c.Stats(ctx, &fstorepb.StatsRequest{})
+}
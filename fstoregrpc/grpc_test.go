@@ -0,0 +1,159 @@
+package fstoregrpc
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+
+	fstore "fStore"
+	"fStore/fstorepb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+func serve(t *testing.T, s *fstore.StoreListener) *Client {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := grpc.NewServer()
+	fstorepb.RegisterFStoreServer(g, NewServer(s))
+	go g.Serve(lis)
+	t.Cleanup(g.Stop)
+
+	cc, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cc.Close() })
+	return NewClient(cc)
+}
+
+func TestServer(t *testing.T) {
+	s := fstore.Listener()
+	s.Threshhold = 5
+	s.UseKeyCompression = true
+	s.CollectStats = true
+	c := serve(t, s)
+	ctx := context.Background()
+
+	in := fstore.NewObject()
+	in.Set("user_agent", "Mozilla/5.0 A")
+	in.Set("cores", 8.0)
+	in.Set("fonts", []any{"Arial", "Helvetica"})
+	id, err := c.Put(ctx, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := c.Get(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := json.Marshal(in)
+	if b, _ := json.Marshal(got); string(b) != string(want) {
+		t.Errorf("got %s, want %s", b, want)
+	}
+
+	// compacted records restore against the server's dictionary
+	compacted, err := c.GetCompacted(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err := s.Restore(compacted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := json.Marshal(restored); string(b) != string(want) {
+		t.Errorf("restored %s, want %s", b, want)
+	}
+
+	results, err := c.Ingest(ctx, []any{
+		map[string]any{"user_agent": "Mozilla/5.0 B"},
+		42, // not a record
+		map[string]any{"user_agent": "Mozilla/5.0 A"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 || results[0].ID != 1 || results[1].Err == nil || results[2].ID != 2 {
+		t.Errorf("unexpected ingest results %v", results)
+	}
+
+	e, err := c.Lookup(ctx, fstore.ValueEntry, "h_0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Value != "Mozilla/5.0 A" || e.Refs != 2 || e.FirstSeen.IsZero() {
+		t.Errorf("unexpected entry %+v", e)
+	}
+
+	st, err := c.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.GetRecords() != 3 || st.GetCalls() != 3 {
+		t.Errorf("unexpected stats %v", st)
+	}
+
+	r := fstore.NewReplica(c.Fetcher(ctx), fstore.ReplicaOptions{UseKeyCompression: true})
+	restored, err = r.Restore(compacted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := json.Marshal(restored); string(b) != string(want) {
+		t.Errorf("replica restored %s, want %s", b, want)
+	}
+
+	if _, err := c.Get(ctx, 42); status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound, got %v", err)
+	}
+	if _, err := c.Ingest(ctx, []any{func() {}}); err == nil {
+		t.Error("expected an error for a record that cannot be sent")
+	}
+}
+
+func TestLiteralValues(t *testing.T) {
+	for in, ref := range map[string]bool{"h_3": true, "~h_3": false, "~~h_3": false, "plain": false} {
+		v, err := ToValue(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := v.GetRef() != ""; got != ref {
+			t.Errorf("%q sent as ref: %v, want %v", in, got, ref)
+		}
+		out, err := FromValue(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != in {
+			t.Errorf("%q came back as %q", in, out)
+		}
+	}
+	if v, _ := ToValue("~h_3"); v.GetStr() != "h_3" {
+		t.Errorf("expected the literal to be sent unescaped, got %q", v.GetStr())
+	}
+}
+
+func TestEscapedKeys(t *testing.T) {
+	obj := fstore.NewObject()
+	obj.Set("$$s", "abc")
+	v, err := ToValue(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k := v.GetObject().GetFields()[0].GetKey(); k != "$s" {
+		t.Errorf("expected the key to be sent unescaped, got %q", k)
+	}
+	out, err := FromValue(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := out.(*fstore.Object).Keys; keys[0] != "$$s" {
+		t.Errorf("expected the key to be escaped again, got %q", keys[0])
+	}
+}
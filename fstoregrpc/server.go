@@ -0,0 +1,174 @@
+// Package fstoregrpc serves a StoreListener over gRPC, using the schema in
+// proto/fstore.proto:
+//
+//	g := grpc.NewServer()
+//	fstorepb.RegisterFStoreServer(g, fstoregrpc.NewServer(fstore.Listener()))
+//
+// Records are sent as JSON, compacted records as a tree of Values, see
+// ToValue.
+package fstoregrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+
+	fstore "fStore"
+	"fStore/fstorepb"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Server implements fstorepb.FStoreServer. Calls to the listener are
+// serialized.
+type Server struct {
+	fstorepb.UnimplementedFStoreServer
+	mu sync.Mutex
+	s  *fstore.StoreListener
+}
+
+func NewServer(s *fstore.StoreListener) *Server {
+	return &Server{s: s}
+}
+
+func (srv *Server) Put(ctx context.Context, req *fstorepb.PutRequest) (*fstorepb.PutResponse, error) {
+	return srv.put(req)
+}
+
+// Ingest stores every streamed record and answers each in order. Records
+// that cannot be stored are answered with an error, the stream goes on.
+func (srv *Server) Ingest(stream fstorepb.FStore_IngestServer) error {
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		resp, err := srv.put(req)
+		if err != nil {
+			resp = &fstorepb.PutResponse{Error: status.Convert(err).Message()}
+		}
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+	}
+}
+
+func (srv *Server) put(req *fstorepb.PutRequest) (*fstorepb.PutResponse, error) {
+	data, err := fstore.DecodeJSON(req.GetJson())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid JSON: %v", err)
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	id, err := srv.s.Put(data)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	rec, _ := srv.s.Compacted(id)
+	v, err := ToValue(rec)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &fstorepb.PutResponse{Id: int64(id), Record: v}, nil
+}
+
+func (srv *Server) Get(ctx context.Context, req *fstorepb.GetRequest) (*fstorepb.GetResponse, error) {
+	srv.mu.Lock()
+	data, err := srv.s.Get(fstore.RecordID(req.GetId()))
+	srv.mu.Unlock()
+	if errors.Is(err, fstore.ErrNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &fstorepb.GetResponse{Json: b}, nil
+}
+
+func (srv *Server) GetCompacted(ctx context.Context, req *fstorepb.GetRequest) (*fstorepb.Value, error) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	rec, ok := srv.s.Compacted(fstore.RecordID(req.GetId()))
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "record %d not found", req.GetId())
+	}
+	v, err := ToValue(rec)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return v, nil
+}
+
+func (srv *Server) Lookup(ctx context.Context, req *fstorepb.LookupRequest) (*fstorepb.Entry, error) {
+	srv.mu.Lock()
+	e, ok := srv.s.Database().Entry(fstore.EntryKind(req.GetKind()), req.GetId())
+	srv.mu.Unlock()
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "%s %q not found", fstore.EntryKind(req.GetKind()), req.GetId())
+	}
+	return toEntry(e), nil
+}
+
+func (srv *Server) Sync(ctx context.Context, req *fstorepb.SyncRequest) (*fstorepb.SyncResponse, error) {
+	since := fstore.Version{
+		Values: int(req.GetSince().GetValues()),
+		Keys:   int(req.GetSince().GetKeys()),
+		Shapes: int(req.GetSince().GetShapes()),
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	d := srv.s.Database()
+	v := d.Version()
+	resp := &fstorepb.SyncResponse{
+		Version: &fstorepb.Version{Values: int64(v.Values), Keys: int64(v.Keys), Shapes: int64(v.Shapes)},
+	}
+	for _, e := range d.Since(since) {
+		resp.Entries = append(resp.Entries, toEntry(e))
+	}
+	return resp, nil
+}
+
+func toEntry(e fstore.Entry) *fstorepb.Entry {
+	entry := &fstorepb.Entry{
+		Kind:  fstorepb.EntryKind(e.Kind),
+		Id:    e.ID,
+		Value: e.Value,
+		Keys:  e.Keys,
+		Refs:  int64(e.Refs),
+	}
+	if !e.FirstSeen.IsZero() {
+		entry.FirstSeen = e.FirstSeen.UnixNano()
+		entry.LastSeen = e.LastSeen.UnixNano()
+	}
+	return entry
+}
+
+func (srv *Server) Stats(ctx context.Context, req *fstorepb.StatsRequest) (*fstorepb.StatsResponse, error) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	st := srv.s.Stats()
+	return &fstorepb.StatsResponse{
+		Calls:           int64(st.Calls),
+		InputBytes:      int64(st.InputBytes),
+		OutputBytes:     int64(st.OutputBytes),
+		DictionaryBytes: int64(st.DictionaryBytes),
+		References:      int64(st.References),
+		NewEntries:      int64(st.NewEntries),
+		ReusedEntries:   int64(st.ReusedEntries),
+		Records:         int64(len(srv.s.RecordIDs())),
+		Entries:         int64(srv.s.Database().Len()),
+	}, nil
+}
@@ -0,0 +1,150 @@
+package fstoregrpc
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	fstore "fStore"
+	"fStore/fstorepb"
+)
+
+// ToValue converts compacted data to its protobuf form. Value ids are sent
+// as refs, other strings and keys as the literal they stand for.
+func ToValue(data any) (*fstorepb.Value, error) {
+	switch v := data.(type) {
+	case nil:
+		return &fstorepb.Value{Kind: &fstorepb.Value_Null{}}, nil
+	case string:
+		if fstore.IsRef(v) {
+			return &fstorepb.Value{Kind: &fstorepb.Value_Ref{Ref: v}}, nil
+		}
+		return &fstorepb.Value{Kind: &fstorepb.Value_Str{Str: fstore.UnescapeLiteral(v)}}, nil
+	case bool:
+		return &fstorepb.Value{Kind: &fstorepb.Value_Bool{Bool: v}}, nil
+	case *fstore.Object:
+		obj := &fstorepb.Object{}
+		for _, k := range v.Keys {
+			val, err := ToValue(v.Values[k])
+			if err != nil {
+				return nil, err
+			}
+			obj.Fields = append(obj.Fields, &fstorepb.Field{Key: fstore.UnescapeKey(k), Value: val})
+		}
+		return &fstorepb.Value{Kind: &fstorepb.Value_Object{Object: obj}}, nil
+	case map[string]any:
+		return ToValue(objectOf(v))
+	case []any:
+		values, err := toValues(v)
+		if err != nil {
+			return nil, err
+		}
+		return &fstorepb.Value{Kind: &fstorepb.Value_List{List: &fstorepb.List{Values: values}}}, nil
+	case *fstore.Shaped:
+		values, err := toValues(v.Values)
+		if err != nil {
+			return nil, err
+		}
+		return &fstorepb.Value{Kind: &fstorepb.Value_Shaped{Shaped: &fstorepb.Shaped{Shape: v.Shape, Values: values}}}, nil
+	case *fstore.Delta:
+		patch, err := ToValue(v.Patch)
+		if err != nil {
+			return nil, err
+		}
+		return &fstorepb.Value{Kind: &fstorepb.Value_Delta{Delta: &fstorepb.Delta{Base: int64(v.Base), Patch: patch}}}, nil
+	}
+
+	rv := reflect.ValueOf(data)
+	switch {
+	case rv.CanInt():
+		return &fstorepb.Value{Kind: &fstorepb.Value_Int{Int: rv.Int()}}, nil
+	case rv.CanUint():
+		return &fstorepb.Value{Kind: &fstorepb.Value_Int{Int: int64(rv.Uint())}}, nil
+	case rv.CanFloat():
+		return &fstorepb.Value{Kind: &fstorepb.Value_Num{Num: rv.Float()}}, nil
+	}
+	return nil, fmt.Errorf("cannot convert %T to a value", data)
+}
+
+func toValues(data []any) ([]*fstorepb.Value, error) {
+	values := make([]*fstorepb.Value, len(data))
+	for i, e := range data {
+		v, err := ToValue(e)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// objectOf turns a map into an *Object with sorted keys, so maps are sent
+// in a stable order.
+func objectOf(m map[string]any) *fstore.Object {
+	obj := fstore.NewObject()
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		obj.Set(k, m[k])
+	}
+	return obj
+}
+
+// FromValue converts a value back to compacted data, as accepted by
+// StoreListener.Restore.
+func FromValue(v *fstorepb.Value) (any, error) {
+	switch k := v.GetKind().(type) {
+	case *fstorepb.Value_Ref:
+		return k.Ref, nil
+	case *fstorepb.Value_Str:
+		return fstore.EscapeLiteral(k.Str), nil
+	case *fstorepb.Value_Num:
+		return k.Num, nil
+	case *fstorepb.Value_Int:
+		return k.Int, nil
+	case *fstorepb.Value_Bool:
+		return k.Bool, nil
+	case *fstorepb.Value_Null:
+		return nil, nil
+	case *fstorepb.Value_Object:
+		obj := fstore.NewObject()
+		for _, f := range k.Object.GetFields() {
+			val, err := FromValue(f.GetValue())
+			if err != nil {
+				return nil, err
+			}
+			obj.Set(fstore.EscapeKey(f.GetKey()), val)
+		}
+		return obj, nil
+	case *fstorepb.Value_List:
+		return fromValues(k.List.GetValues())
+	case *fstorepb.Value_Shaped:
+		values, err := fromValues(k.Shaped.GetValues())
+		if err != nil {
+			return nil, err
+		}
+		return &fstore.Shaped{Shape: k.Shaped.GetShape(), Values: values}, nil
+	case *fstorepb.Value_Delta:
+		patch, err := FromValue(k.Delta.GetPatch())
+		if err != nil {
+			return nil, err
+		}
+		return &fstore.Delta{Base: fstore.RecordID(k.Delta.GetBase()), Patch: patch}, nil
+	}
+	return nil, fmt.Errorf("value without kind")
+}
+
+func fromValues(values []*fstorepb.Value) ([]any, error) {
+	res := make([]any, len(values))
+	for i, v := range values {
+		e, err := FromValue(v)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = e
+	}
+	return res, nil
+}
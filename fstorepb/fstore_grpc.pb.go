@@ -0,0 +1,356 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: fstore.proto
+
+package fstorepb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	FStore_Put_FullMethodName          = "/fstore.v1.FStore/Put"
+	FStore_Ingest_FullMethodName       = "/fstore.v1.FStore/Ingest"
+	FStore_Get_FullMethodName          = "/fstore.v1.FStore/Get"
+	FStore_GetCompacted_FullMethodName = "/fstore.v1.FStore/GetCompacted"
+	FStore_Lookup_FullMethodName       = "/fstore.v1.FStore/Lookup"
+	FStore_Sync_FullMethodName         = "/fstore.v1.FStore/Sync"
+	FStore_Stats_FullMethodName        = "/fstore.v1.FStore/Stats"
+)
+
+// FStoreClient is the client API for FStore service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type FStoreClient interface {
+	// Put compacts and stores a record.
+	Put(ctx context.Context, in *PutRequest, opts ...grpc.CallOption) (*PutResponse, error)
+	// Ingest stores a stream of records, answering each in order.
+	Ingest(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[PutRequest, PutResponse], error)
+	// Get returns a restored record.
+	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error)
+	// GetCompacted returns a record as it is stored.
+	GetCompacted(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*Value, error)
+	// Lookup returns a dictionary entry.
+	Lookup(ctx context.Context, in *LookupRequest, opts ...grpc.CallOption) (*Entry, error)
+	// Sync returns the dictionary entries a client is missing.
+	Sync(ctx context.Context, in *SyncRequest, opts ...grpc.CallOption) (*SyncResponse, error)
+	Stats(ctx context.Context, in *StatsRequest, opts ...grpc.CallOption) (*StatsResponse, error)
+}
+
+type fStoreClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewFStoreClient(cc grpc.ClientConnInterface) FStoreClient {
+	return &fStoreClient{cc}
+}
+
+func (c *fStoreClient) Put(ctx context.Context, in *PutRequest, opts ...grpc.CallOption) (*PutResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PutResponse)
+	err := c.cc.Invoke(ctx, FStore_Put_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fStoreClient) Ingest(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[PutRequest, PutResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &FStore_ServiceDesc.Streams[0], FStore_Ingest_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[PutRequest, PutResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FStore_IngestClient = grpc.BidiStreamingClient[PutRequest, PutResponse]
+
+func (c *fStoreClient) Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetResponse)
+	err := c.cc.Invoke(ctx, FStore_Get_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fStoreClient) GetCompacted(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*Value, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Value)
+	err := c.cc.Invoke(ctx, FStore_GetCompacted_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fStoreClient) Lookup(ctx context.Context, in *LookupRequest, opts ...grpc.CallOption) (*Entry, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Entry)
+	err := c.cc.Invoke(ctx, FStore_Lookup_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fStoreClient) Sync(ctx context.Context, in *SyncRequest, opts ...grpc.CallOption) (*SyncResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SyncResponse)
+	err := c.cc.Invoke(ctx, FStore_Sync_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fStoreClient) Stats(ctx context.Context, in *StatsRequest, opts ...grpc.CallOption) (*StatsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(StatsResponse)
+	err := c.cc.Invoke(ctx, FStore_Stats_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// FStoreServer is the server API for FStore service.
+// All implementations must embed UnimplementedFStoreServer
+// for forward compatibility.
+type FStoreServer interface {
+	// Put compacts and stores a record.
+	Put(context.Context, *PutRequest) (*PutResponse, error)
+	// Ingest stores a stream of records, answering each in order.
+	Ingest(grpc.BidiStreamingServer[PutRequest, PutResponse]) error
+	// Get returns a restored record.
+	Get(context.Context, *GetRequest) (*GetResponse, error)
+	// GetCompacted returns a record as it is stored.
+	GetCompacted(context.Context, *GetRequest) (*Value, error)
+	// Lookup returns a dictionary entry.
+	Lookup(context.Context, *LookupRequest) (*Entry, error)
+	// Sync returns the dictionary entries a client is missing.
+	Sync(context.Context, *SyncRequest) (*SyncResponse, error)
+	Stats(context.Context, *StatsRequest) (*StatsResponse, error)
+	mustEmbedUnimplementedFStoreServer()
+}
+
+// UnimplementedFStoreServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedFStoreServer struct{}
+
+func (UnimplementedFStoreServer) Put(context.Context, *PutRequest) (*PutResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Put not implemented")
+}
+func (UnimplementedFStoreServer) Ingest(grpc.BidiStreamingServer[PutRequest, PutResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method Ingest not implemented")
+}
+func (UnimplementedFStoreServer) Get(context.Context, *GetRequest) (*GetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedFStoreServer) GetCompacted(context.Context, *GetRequest) (*Value, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetCompacted not implemented")
+}
+func (UnimplementedFStoreServer) Lookup(context.Context, *LookupRequest) (*Entry, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Lookup not implemented")
+}
+func (UnimplementedFStoreServer) Sync(context.Context, *SyncRequest) (*SyncResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Sync not implemented")
+}
+func (UnimplementedFStoreServer) Stats(context.Context, *StatsRequest) (*StatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Stats not implemented")
+}
+func (UnimplementedFStoreServer) mustEmbedUnimplementedFStoreServer() {}
+func (UnimplementedFStoreServer) testEmbeddedByValue()                {}
+
+// UnsafeFStoreServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to FStoreServer will
+// result in compilation errors.
+type UnsafeFStoreServer interface {
+	mustEmbedUnimplementedFStoreServer()
+}
+
+func RegisterFStoreServer(s grpc.ServiceRegistrar, srv FStoreServer) {
+	// If the following call pancis, it indicates UnimplementedFStoreServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&FStore_ServiceDesc, srv)
+}
+
+func _FStore_Put_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PutRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FStoreServer).Put(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FStore_Put_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FStoreServer).Put(ctx, req.(*PutRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FStore_Ingest_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(FStoreServer).Ingest(&grpc.GenericServerStream[PutRequest, PutResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FStore_IngestServer = grpc.BidiStreamingServer[PutRequest, PutResponse]
+
+func _FStore_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FStoreServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FStore_Get_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FStoreServer).Get(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FStore_GetCompacted_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FStoreServer).GetCompacted(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FStore_GetCompacted_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FStoreServer).GetCompacted(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FStore_Lookup_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LookupRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FStoreServer).Lookup(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FStore_Lookup_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FStoreServer).Lookup(ctx, req.(*LookupRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FStore_Sync_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SyncRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FStoreServer).Sync(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FStore_Sync_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FStoreServer).Sync(ctx, req.(*SyncRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FStore_Stats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FStoreServer).Stats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FStore_Stats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FStoreServer).Stats(ctx, req.(*StatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// FStore_ServiceDesc is the grpc.ServiceDesc for FStore service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var FStore_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "fstore.v1.FStore",
+	HandlerType: (*FStoreServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Put",
+			Handler:    _FStore_Put_Handler,
+		},
+		{
+			MethodName: "Get",
+			Handler:    _FStore_Get_Handler,
+		},
+		{
+			MethodName: "GetCompacted",
+			Handler:    _FStore_GetCompacted_Handler,
+		},
+		{
+			MethodName: "Lookup",
+			Handler:    _FStore_Lookup_Handler,
+		},
+		{
+			MethodName: "Sync",
+			Handler:    _FStore_Sync_Handler,
+		},
+		{
+			MethodName: "Stats",
+			Handler:    _FStore_Stats_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Ingest",
+			Handler:       _FStore_Ingest_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "fstore.proto",
+}
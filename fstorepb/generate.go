@@ -0,0 +1,5 @@
+// Package fstorepb holds the protobuf messages and gRPC stubs generated from
+// proto/fstore.proto. See package fstoregrpc for the server and client.
+package fstorepb
+
+//go:generate protoc -I ../proto --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative fstore.proto
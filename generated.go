@@ -0,0 +1,77 @@
+package fstore
+
+import (
+	"fmt"
+	"reflect"
+
+	"golang.org/x/exp/slices"
+)
+
+// The functions below are used by the compactors fstoregen generates, so
+// generated code follows the same dictionary and policy semantics as Store.
+// name is the stored name of the value, path is used in errors and logs.
+
+// CompactString compacts a string like Store would.
+func (s *StoreListener) CompactString(name, path, v string) any {
+	return s.compactString(v, slices.Contains(s.DontHash, name), path)
+}
+
+// CompactFloat compacts a float64 like Store would.
+func (s *StoreListener) CompactFloat(name, path string, v float64) any {
+	return s.compactFloat(v, slices.Contains(s.DontHash, name), path)
+}
+
+// CompactInt64 compacts an int64 like Store would.
+func (s *StoreListener) CompactInt64(name, path string, v int64) any {
+	return s.compactInt64(v, slices.Contains(s.DontHash, name), path)
+}
+
+// CompactValue compacts v using reflection. Generated code falls back to it
+// for types it does not know.
+func (s *StoreListener) CompactValue(name, path string, v any) (any, error) {
+	return s.getFieldValue(reflect.ValueOf(v), slices.Contains(s.DontHash, name), path)
+}
+
+// Decode stores already restored data in the value pointed to by v.
+func (s *StoreListener) Decode(data any, v any) error {
+	ref := reflect.ValueOf(v)
+	if ref.Kind() != reflect.Pointer || ref.IsNil() {
+		return fmt.Errorf("could not decode into %T, need a non-nil pointer", v)
+	}
+	return s.decode(data, ref.Elem(), "")
+}
+
+// RestoredFields returns the fields of a restored object.
+func RestoredFields(data any) (map[string]any, bool) {
+	switch v := data.(type) {
+	case map[string]any:
+		return v, true
+	case *Object:
+		return v.Values, true
+	}
+	return nil, false
+}
+
+// RestoredString returns the restored string in data, or "" if there is none.
+func RestoredString(data any) string {
+	str, _ := data.(string)
+	return str
+}
+
+// RestoredFloat returns the restored number in data, or 0 if there is none.
+func RestoredFloat(data any) float64 {
+	f, _ := toFloat(data)
+	return f
+}
+
+// RestoredInt returns the restored number in data, or 0 if there is none.
+func RestoredInt(data any) int64 {
+	i, _ := toInt(data)
+	return i
+}
+
+// RestoredBool returns the restored bool in data, or false if there is none.
+func RestoredBool(data any) bool {
+	b, _ := data.(bool)
+	return b
+}
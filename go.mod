@@ -1,10 +1,18 @@
 module fStore
 
-go 1.20
+go 1.22
 
 require (
 	github.com/go-delve/delve v1.21.1
 	golang.org/x/exp v0.0.0-20231006140011-7918f672742d
+	google.golang.org/grpc v1.67.1
+	google.golang.org/protobuf v1.35.1
 )
 
-require github.com/aviate-labs/leb128 v0.3.0 // indirect
+require (
+	github.com/aviate-labs/leb128 v0.3.0 // indirect
+	golang.org/x/net v0.28.0 // indirect
+	golang.org/x/sys v0.24.0 // indirect
+	golang.org/x/text v0.17.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240814211410-ddb44dafa142 // indirect
+)
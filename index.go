@@ -0,0 +1,180 @@
+package fstore
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// index maps the compacted values found at a path to the records holding
+// them.
+type index struct {
+	path   compiledPredicate // only used to match paths, "[*]" is allowed
+	values map[string]*Bitmap
+}
+
+// indexKey returns the key a compacted leaf value is indexed under.
+// Numbers are compared as float64, like in queries.
+func indexKey(v any) string {
+	if v == nil {
+		return "null"
+	}
+	switch v := v.(type) {
+	case string:
+		return "s:" + v
+	case bool:
+		return "b:" + strconv.FormatBool(v)
+	}
+	if f, ok := toFloat(v); ok {
+		return "n:" + strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	return fmt.Sprintf("%T:%v", v, v)
+}
+
+// AddIndex maintains a secondary index on path, like "user_agent" or
+// "tls.peetprint_hash", so Lookup and Query find records by the value at
+// path without matching every record. Existing records are indexed
+// right away, later ones on Put, Delete removes them.
+func (s *StoreListener) AddIndex(path string) error {
+	if _, ok := s.indexes[path]; ok {
+		return nil
+	}
+	idx := &index{
+		path:   compiledPredicate{Predicate: Predicate{Path: path}, wildcard: strings.Contains(path, "[*]")},
+		values: map[string]*Bitmap{},
+	}
+	for _, id := range s.RecordIDs() {
+		rec, err := s.compactedFull(s.records.records[id])
+		if err != nil {
+			return fmt.Errorf("could not index record %d: %w", id, err)
+		}
+		idx.update(s, id, rec, true)
+	}
+	s.indexes[path] = idx
+	return nil
+}
+
+// Indexes returns the indexed paths, sorted.
+func (s *StoreListener) Indexes() []string {
+	paths := make([]string, 0, len(s.indexes))
+	for p := range s.indexes {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Lookup returns the ids of the records whose value at an indexed path
+// equals one of vals, in ascending order.
+func (s *StoreListener) Lookup(path string, vals ...any) ([]RecordID, error) {
+	idx, ok := s.indexes[path]
+	if !ok {
+		return nil, fmt.Errorf("no index on %q", path)
+	}
+	c := s.compile(In(path, vals...))
+	return toRecordIDs(idx.lookup(&c)), nil
+}
+
+// update adds or removes a record for every value it has at the path.
+func (idx *index) update(s *StoreListener, id RecordID, rec any, add bool) {
+	s.walkLeaves(rec, "", func(path string, v any) {
+		if !idx.path.matchesPath(path) {
+			return
+		}
+		key := indexKey(v)
+		bm, ok := idx.values[key]
+		if !add {
+			if ok {
+				bm.Remove(uint32(id))
+				if bm.Len() == 0 {
+					delete(idx.values, key)
+				}
+			}
+			return
+		}
+		if !ok {
+			bm = NewBitmap()
+			idx.values[key] = bm
+		}
+		bm.Add(uint32(id))
+	})
+}
+
+// lookup returns the records matching a compiled Eq or In predicate.
+func (idx *index) lookup(c *compiledPredicate) *Bitmap {
+	keys := []string{}
+	for str := range c.strs {
+		keys = append(keys, indexKey(str))
+	}
+	for _, n := range c.nums {
+		keys = append(keys, indexKey(n))
+	}
+	for _, v := range c.vals {
+		if b, ok := v.(bool); ok {
+			keys = append(keys, indexKey(b))
+		}
+	}
+	if c.null {
+		keys = append(keys, indexKey(nil))
+	}
+
+	res := NewBitmap()
+	for _, k := range keys {
+		if bm, ok := idx.values[k]; ok {
+			res = res.Or(bm)
+		}
+	}
+	return res
+}
+
+// indexRecord updates all indexes, including the one of Similar, for a
+// record that is added or removed. Nothing is changed if it fails.
+func (s *StoreListener) indexRecord(id RecordID, rec any, add bool) error {
+	if len(s.indexes) == 0 && s.lsh == nil {
+		return nil
+	}
+	full, err := s.compactedFull(rec)
+	if err != nil {
+		return fmt.Errorf("could not index record %d: %w", id, err)
+	}
+	for _, idx := range s.indexes {
+		idx.update(s, id, full, add)
+	}
+	if s.lsh != nil {
+		if add {
+			s.lsh.add(id, s.minhash(full))
+		} else {
+			s.lsh.remove(id)
+		}
+	}
+	return nil
+}
+
+// candidates returns the records that can match the predicates according
+// to the indexes, or false if no predicate can use an index.
+func (s *StoreListener) candidates(preds []compiledPredicate) (*Bitmap, bool) {
+	var res *Bitmap
+	for i := range preds {
+		p := &preds[i]
+		idx, ok := s.indexes[p.Path]
+		if !ok || (p.op != opEq && p.op != opIn) {
+			continue
+		}
+		bm := idx.lookup(p)
+		if res == nil {
+			res = bm
+		} else {
+			res = res.And(bm)
+		}
+	}
+	return res, res != nil
+}
+
+func toRecordIDs(bm *Bitmap) []RecordID {
+	var ids []RecordID
+	for _, v := range bm.ToSlice() {
+		ids = append(ids, RecordID(v))
+	}
+	return ids
+}
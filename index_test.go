@@ -0,0 +1,76 @@
+package fstore
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIndex(t *testing.T) {
+	f := queryListener(t)
+	if err := f.AddIndex("tls.ja3_hash"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.AddIndex("languages[*]"); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := f.Lookup("tls.ja3_hash", "aaa111aaa111")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []RecordID{0, 1, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// maintained on Put and Delete
+	id, err := f.Put(map[string]any{"tls": map[string]any{"ja3_hash": "bbb222bbb222"}, "languages": []any{"de-DE"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Delete(0); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := f.Lookup("tls.ja3_hash", "aaa111aaa111", "bbb222bbb222"); !reflect.DeepEqual(got, []RecordID{1, 2, 3, id}) {
+		t.Errorf("got %v after put and delete", got)
+	}
+	if got, _ := f.Lookup("languages[*]", "de-DE"); !reflect.DeepEqual(got, []RecordID{id}) {
+		t.Errorf("got %v for wildcard index", got)
+	}
+
+	got, err = f.Query(Eq("tls.ja3_hash", "aaa111aaa111"), Eq("HighEntropyValues.platform", "macOS"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []RecordID{3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("query got %v, want %v", got, want)
+	}
+
+	if _, err := f.Lookup("user_agent", "x"); err == nil {
+		t.Error("expected an error for a path without index")
+	}
+}
+
+func TestIndexErrors(t *testing.T) {
+	f := queryListener(t)
+	for _, p := range []string{"tls.ja3_hash", "languages[*]", "HighEntropyValues.platform"} {
+		if err := f.AddIndex(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := f.Indexes(), []string{"HighEntropyValues.platform", "languages[*]", "tls.ja3_hash"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got indexes %v, want %v", got, want)
+	}
+
+	ids := f.RecordIDs()
+	if _, err := f.addRecord(&Delta{Base: 99, Patch: map[string]any{}}); err == nil {
+		t.Error("expected an error for a delta to an unknown record")
+	}
+	if !reflect.DeepEqual(f.RecordIDs(), ids) {
+		t.Error("the record was added although it could not be indexed")
+	}
+
+	f.records.records[99] = &Delta{Base: 98, Patch: map[string]any{}}
+	if err := f.Delete(99); err == nil {
+		t.Error("expected an error for a record that cannot be indexed")
+	}
+}
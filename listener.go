@@ -1,156 +1,374 @@
 package fstore
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
+	"os"
 	"reflect"
+	"sort"
 	"strings"
+	"sync"
 
 	"golang.org/x/exp/slices"
 )
 
 type StoreListener struct {
+	// DontHash, Threshhold and UseKeyCompression can be changed between
+	// Store calls: struct plans are compiled per setting.
 	DontHash          []string
 	Threshhold        int
 	UseKeyCompression bool
-	debug             bool
+	UseShapes         bool // store objects as a shape reference plus values
+	CollectStats      bool // measure every Store call, see Stats
+	Strict            bool // fail on values that cannot be compacted
+	Fallback          FallbackEncoder
+	Clustering        ClusterOptions
+	logger            *slog.Logger
+	codecs            map[reflect.Type]Codec
+	plans             sync.Map // planKey -> *structPlan
+	typeCodecs        sync.Map // reflect.Type -> Codec
 	database          Database
+	records           recordStore
+	clusters          map[string][]*cluster // prototypes per group
+	indexes           map[string]*index     // secondary indexes by path
+	lsh               *lshIndex             // built by the first Similar call
+	stats             Stats
 }
 
 func Listener() *StoreListener {
 	return &StoreListener{
 		database: GetDatabase(),
+		records:  newRecordStore(),
+		clusters: map[string][]*cluster{},
+		indexes:  map[string]*index{},
 		DontHash: []string{},
+		codecs:   map[reflect.Type]Codec{},
 	}
 }
 
-func (s *StoreListener) log(l ...any) {
-	if !s.debug {
+func (s *StoreListener) log(level slog.Level, msg string, args ...any) {
+	if s.logger == nil {
 		return
 	}
-	fmt.Print("[Listener] ")
-	fmt.Println(l...)
+	s.logger.Log(context.Background(), level, msg, args...)
 }
 
+// EnableDebug logs every step of the walk to stdout. Use SetLogger to send
+// the output somewhere else.
 func (s *StoreListener) EnableDebug() {
-	s.debug = true
+	s.logger = slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+	}))
 }
 
-func (s *StoreListener) getStructValue(ref reflect.Value) any {
-	fields := ref.NumField()
+// SetLogger sets the logger used for the walk, hashing decisions and
+// unhandled kinds. A nil logger disables logging. StoreBatchParallel logs
+// from several goroutines, slog handlers are safe for that.
+func (s *StoreListener) SetLogger(l *slog.Logger) {
+	s.logger = l
+}
+
+// fieldName returns the name a struct field is stored under, taken from
+// its json tag.
+func fieldName(f reflect.StructField) string {
+	jsonTag := f.Tag.Get("json")
+	name := strings.Replace(jsonTag, ",omitonempty", "", -1)
+	return strings.Replace(name, ",omitempty", "", -1)
+}
+
+// joinPath appends a key to a dotted path like "tls.extensions".
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func indexPath(path string, i int) string {
+	return fmt.Sprintf("%s[%d]", path, i)
+}
+
+func (s *StoreListener) saveKey(name string) string {
+	if !s.UseKeyCompression {
+		return EscapeKey(name)
+	}
+	id := s.database.SaveKey(name)
+	s.log(slog.LevelDebug, "compressed key", "key", name, "id", id)
+	return id
+}
+
+func (s *StoreListener) saveHash(path string, kind reflect.Kind, val string) string {
+	id := s.database.SaveHash(val)
+	s.log(slog.LevelDebug, "hashed value", "path", path, "kind", kind, "id", id)
+	return id
+}
 
-	result := map[string]any{}
-	for i := 0; i < fields; i++ {
-		field := ref.Field(i)
-		jsonTag := ref.Type().Field(i).Tag.Get("json")
-		name := strings.Replace(jsonTag, ",omitonempty", "", -1)
-		name = strings.Replace(name, ",omitempty", "", -1)
+func (s *StoreListener) getStructValue(ref reflect.Value, path string) (any, error) {
+	plan := s.planFor(ref.Type())
 
-		val := s.getFieldValue(field, name)
+	result := s.NewFieldSet()
+	for i := range plan.fields {
+		fp := &plan.fields[i]
+		field := ref.Field(fp.index)
+
+		val, err := s.getFieldValue(field, fp.dontHash, joinPath(path, fp.name))
+		if err != nil {
+			return nil, err
+		}
+		if val == nil && !field.CanInterface() {
+			// skipped, see unsupported
+			continue
+		}
 		if !isEmpty(val) {
-			n := name
-			if s.UseKeyCompression {
-				n = s.database.SaveKey(name)
-			}
-			result[n] = val
+			result.add(s.fieldKey(fp), val)
 		}
 	}
 
-	return result
+	return result.Value(), nil
 }
 
-func (s *StoreListener) getMapValue(ref reflect.Value) any {
-	fields := ref.MapKeys()
+// fieldKey returns the key a planned field is stored under. The key id is
+// saved when the field is first stored and cached in the plan, later calls
+// only count the reference, like SaveKey does for known keys.
+func (s *StoreListener) fieldKey(fp *fieldPlan) string {
+	if s.UseShapes {
+		return fp.name
+	}
+	if !s.UseKeyCompression {
+		return EscapeKey(fp.name)
+	}
+	if fp.key == "" {
+		fp.key = s.saveKey(fp.name)
+		return fp.key
+	}
+	s.database.reuse(KeyEntry, fp.key)
+	return fp.key
+}
 
-	result := map[string]any{}
-	for _, fieldName := range fields {
-		field := ref.MapIndex(fieldName)
-		s.log("tmp:", field, field.Elem(), field.Type())
-		name := fieldName.String()
-		s.log(name)
-		val := s.getFieldValue(field, name)
-		if !isEmpty(val) {
-			n := name
-			if s.UseKeyCompression {
-				n = s.database.SaveKey(name)
-			}
-			result[n] = val
+func (s *StoreListener) getMapValue(ref reflect.Value, path string) (any, error) {
+	type mapKey struct {
+		key  reflect.Value
+		name string
+	}
+	fields := make([]mapKey, 0, ref.Len())
+	for _, k := range ref.MapKeys() {
+		fields = append(fields, mapKey{k, mapKeyName(k)})
+	}
+	// visit keys sorted, so dictionary ids do not depend on the map
+	// iteration order
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].name < fields[j].name
+	})
+
+	result := s.NewFieldSet()
+	for _, f := range fields {
+		field := ref.MapIndex(f.key)
+		name := f.name
+		val, err := s.getFieldValue(field, slices.Contains(s.DontHash, name), joinPath(path, name))
+		if err != nil {
+			return nil, err
 		}
+		result.Set(name, val)
 	}
 
-	return result
+	return result.Value(), nil
 }
 
-func (s *StoreListener) getFieldValue(field reflect.Value, name string) any {
+// mapKeyName returns the name a map key is stored under. Value.String
+// only works for string keys, it returns "<int Value>" for others.
+func mapKeyName(k reflect.Value) string {
+	if k.Kind() == reflect.String {
+		return k.String()
+	}
+	return fmt.Sprint(k.Interface())
+}
 
-	if field.Kind() == reflect.String {
-		str := field.String()
-		if len(str) < s.Threshhold && !slices.Contains(s.DontHash, name) {
-			return str
+func (s *StoreListener) getSliceValue(ref reflect.Value, path string) (any, error) {
+	result := []any{}
+	for i := 0; i < ref.Len(); i++ {
+		val, err := s.getFieldValue(ref.Index(i), false, indexPath(path, i))
+		if err != nil {
+			return nil, err
 		}
-		// s.log("=== hashing", name, "===")
-		return s.database.SaveHash(str)
-	} else if field.Kind() == reflect.Float64 {
-		i := field.Float()
-		if !slices.Contains(s.DontHash, name) {
-			return i
+		result = append(result, val)
+	}
+	return result, nil
+}
+
+func (s *StoreListener) compactString(str string, dontHash bool, path string) any {
+	if len(str) < s.Threshhold && !dontHash {
+		s.log(slog.LevelDebug, "kept value", "path", path, "kind", reflect.String)
+		return EscapeLiteral(str)
+	}
+	return s.saveHash(path, reflect.String, str)
+}
+
+func (s *StoreListener) compactFloat(i float64, dontHash bool, path string) any {
+	if !dontHash {
+		return i
+	}
+	return s.saveHash(path, reflect.Float64, fmt.Sprintf("%v", i))
+}
+
+func (s *StoreListener) compactInt64(i int64, dontHash bool, path string) any {
+	if !dontHash {
+		return i
+	}
+	return s.saveHash(path, reflect.Int64, fmt.Sprintf("%v", i))
+}
+
+// getFieldValue compacts a single value. dontHash is set if the value is
+// stored under a name listed in DontHash.
+func (s *StoreListener) getFieldValue(field reflect.Value, dontHash bool, path string) (any, error) {
+	// values of unexported fields cannot be passed to codecs
+	if field.IsValid() && field.CanInterface() {
+		// checked before the codecs, Object implements json.Marshaler
+		if field.Type() == objectType && !field.IsNil() {
+			return s.getObjectValue(field.Interface().(*Object), path)
 		}
-		return s.database.SaveHash(fmt.Sprintf("%v", i))
-	} else if field.Kind() == reflect.Int64 {
-		i := field.Int()
-		if !slices.Contains(s.DontHash, name) {
-			return i
+		if codec := s.cachedCodecFor(field.Type()); codec != nil {
+			enc, err := codec.Encode(field)
+			if err != nil {
+				return nil, fmt.Errorf("could not encode %q: %w", path, err)
+			}
+			s.log(slog.LevelDebug, "encoded", "path", path, "type", field.Type())
+			return s.getFieldValue(reflect.ValueOf(enc), dontHash, path)
 		}
-		return s.database.SaveHash(fmt.Sprintf("%v", i))
+	}
+
+	if field.Kind() == reflect.String {
+		return s.compactString(field.String(), dontHash, path), nil
+	} else if field.Kind() == reflect.Float64 {
+		return s.compactFloat(field.Float(), dontHash, path), nil
+	} else if field.Kind() == reflect.Int64 {
+		return s.compactInt64(field.Int(), dontHash, path), nil
 	} else if field.Kind() == reflect.Struct {
-		return s.getStructValue(field)
-	} else if field.Kind() == reflect.Slice {
-		result := []any{}
-		for i := 0; i < field.Len(); i++ {
-			result = append(result, s.getFieldValue(field.Index(i), ""))
-		}
-		return result
+		return s.getStructValue(field, path)
+	} else if field.Kind() == reflect.Slice || field.Kind() == reflect.Array {
+		return s.getSliceValue(field, path)
 	} else if field.Kind() == reflect.Int {
-		return field.Int()
+		return field.Int(), nil
 	} else if field.Kind() == reflect.Map {
-		return s.getMapValue(field)
+		return s.getMapValue(field, path)
 	} else if field.Kind() == reflect.Interface {
-		return s.getFieldValue(reflect.ValueOf(field.Interface()), "")
+		if field.IsNil() {
+			return nil, nil
+		}
+		return s.getFieldValue(field.Elem(), dontHash, path)
+	} else if field.Kind() == reflect.Pointer {
+		if field.IsNil() {
+			return nil, nil
+		}
+		return s.getFieldValue(field.Elem(), dontHash, path)
+	} else if field.Kind() == reflect.Invalid {
+		// untyped nil, e.g. a JSON null decoded into an interface
+		return nil, nil
+	} else if isScalar(field.Kind()) && field.CanInterface() {
+		return field.Interface(), nil
+	}
+
+	return s.unsupported(field, path)
+}
+
+// unsupported handles values the walker cannot compact. Values of
+// unexported fields are skipped. Otherwise, in strict mode it returns an
+// UnsupportedError, and the value is passed to the Fallback encoder, if
+// there is one.
+func (s *StoreListener) unsupported(field reflect.Value, path string) (any, error) {
+	if !field.CanInterface() {
+		s.log(slog.LevelDebug, "skipped unexported value", "path", path, "kind", field.Kind())
+		return nil, nil
+	}
+	if s.Strict {
+		return nil, &UnsupportedError{Path: path, Kind: field.Kind()}
+	}
+	if s.Fallback != nil {
+		s.log(slog.LevelDebug, "fallback", "path", path, "kind", field.Kind())
+		return s.Fallback(path, field)
 	}
 
-	s.log("== UNHANDLED", field.Kind(), field.Interface())
-	return field.Interface()
+	s.log(slog.LevelWarn, "unhandled kind", "path", path, "kind", field.Kind())
+	return field.Interface(), nil
 }
 
 func (s *StoreListener) storeStruct(data interface{}) (any, error) {
 	ref := reflect.ValueOf(data)
 
-	result := s.getStructValue(ref)
-
-	return result, nil
+	return s.getStructValue(ref, "")
 }
 
 func (s *StoreListener) storeString(data string) (any, error) {
-	s.log("Saving string", data)
-	return data, nil
-}
-func (s *StoreListener) storeArray(data []any) (any, error) {
-	s.log("Saving array")
-	return data, nil
+	s.log(slog.LevelDebug, "saving string")
+	return EscapeLiteral(data), nil
 }
 
+// Store compacts data and returns the result. If CollectStats is set, the
+// call is added to the cumulative Stats.
 func (s *StoreListener) Store(data any) (any, error) {
+	if s.CollectStats {
+		res, _, err := s.StoreWithStats(data)
+		return res, err
+	}
+	return s.store(data)
+}
+
+// StoreWithStats works like Store, but also reports how much the call saved.
+// The call is always added to the cumulative Stats, unless its input cannot
+// be encoded as JSON, like values left to the Fallback encoder. Then the
+// stats are zero.
+func (s *StoreListener) StoreWithStats(data any) (any, Stats, error) {
+	before := s.database.counters
+	res, err := s.store(data)
+	if err != nil {
+		return nil, Stats{}, err
+	}
+	return res, s.collect(data, res, before), nil
+}
+
+// collect measures a Store call and adds it to the cumulative Stats. A call
+// that cannot be measured is logged and skipped, its data is stored anyway.
+func (s *StoreListener) collect(data, res any, before dictCounters) Stats {
+	st, err := measure(data, res, before, s.database.counters)
+	if err != nil {
+		s.log(slog.LevelWarn, "skipped stats", "err", err)
+		return Stats{}
+	}
+	s.stats.add(st)
+	return st
+}
+
+// Stats returns the cumulative stats of all measured Store calls.
+func (s *StoreListener) Stats() Stats {
+	return s.stats
+}
+
+func (s *StoreListener) store(data any) (any, error) {
+	defer s.database.begin()()
+	if s.UseKeyCompression {
+		s.database.compressedKeys = true
+	}
 	reflectVal := reflect.ValueOf(data)
 	reflectKind := reflectVal.Kind()
-	s.log("Type: ", reflectKind)
+	s.log(slog.LevelDebug, "store", "kind", reflectKind)
+	if obj, ok := data.(*Object); ok && obj != nil {
+		return s.getObjectValue(obj, "")
+	}
 	switch reflectKind {
 	case reflect.Struct:
 		return s.storeStruct(reflectVal.Interface())
 	case reflect.Map:
-		return s.getMapValue(reflectVal), nil
+		return s.getMapValue(reflectVal, "")
 	case reflect.Array:
-		return s.storeArray(data.([]any))
+		return s.getSliceValue(reflectVal, "")
 	case reflect.Pointer:
-		return s.storeStruct(reflectVal.Elem().Interface())
+		if reflectVal.IsNil() {
+			return nil, fmt.Errorf("could not store a nil %s", reflectVal.Type())
+		}
+		if reflectVal.Elem().Kind() == reflect.Struct {
+			return s.storeStruct(reflectVal.Elem().Interface())
+		}
+		return s.getFieldValue(reflectVal.Elem(), false, "")
 	case reflect.String:
 		return s.storeString(data.(string))
 	default:
@@ -1,11 +1,18 @@
 package fstore
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"reflect"
 	"testing"
 )
 
+//go:generate go run ./cmd/fstoregen -file listener_test.go -output example_fstore_test.go
+
+//fstore:generate
 type ExampleStruct struct {
 	IP          string `json:"ip"`
 	HTTPVersion string `json:"http_version"`
@@ -6937,11 +6944,360 @@ func TestStruct(m *testing.T) {
 
 	res, _ := f.Store(data)
 	smolData, _ := json.Marshal(res)
-	valLookup, _ := json.Marshal(f.database.hashValues)
-	keyLookup, _ := json.Marshal(f.database.hashKeys)
+	lookup := func(kind EntryKind) []byte {
+		m := map[string]string{}
+		for _, e := range f.Database().Entries(kind) {
+			m[e.ID] = e.Value
+		}
+		b, _ := json.Marshal(m)
+		return b
+	}
+	valLookup, keyLookup := lookup(ValueEntry), lookup(KeyEntry)
 	fmt.Println("Data:", string(smolData))
 	fmt.Print("\n==\n\n")
 	fmt.Println("val lookup:", string(valLookup))
 	fmt.Print("\n==\n\n")
 	fmt.Println("key lookup:", string(keyLookup))
 }
+
+func TestStats(t *testing.T) {
+	var data map[string]any
+	if err := json.Unmarshal(fp2, &data); err != nil {
+		t.Fatal(err)
+	}
+	f := Listener()
+	f.Threshhold = 5
+	f.UseKeyCompression = true
+
+	_, first, err := f.StoreWithStats(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, second, err := f.StoreWithStats(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.NewEntries == 0 || first.References != first.NewEntries+first.ReusedEntries {
+		t.Errorf("unexpected first stats: %v", first)
+	}
+	if second.NewEntries != 0 || second.DictionaryBytes != 0 {
+		t.Errorf("storing the same data twice should only reuse entries: %v", second)
+	}
+	if second.OutputBytes >= second.InputBytes {
+		t.Errorf("expected output to be smaller than input: %v", second)
+	}
+
+	total := f.Stats()
+	if total.Calls != 2 || total.References != first.References+second.References {
+		t.Errorf("unexpected cumulative stats: %v", total)
+	}
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	f := Listener()
+	f.Threshhold = 5
+	f.SetLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	if _, err := f.Store(map[string]any{"tls": map[string]any{"ja3_hash": "e2a0d3c4b4a3e2c6"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	var entry struct {
+		Msg  string `json:"msg"`
+		Path string `json:"path"`
+		ID   string `json:"id"`
+	}
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		if err := json.Unmarshal(line, &entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry.Msg == "hashed value" {
+			break
+		}
+	}
+	if entry.Msg != "hashed value" || entry.Path != "tls.ja3_hash" || entry.ID != "h_0" {
+		t.Errorf("unexpected log entry: %+v\n%s", entry, buf.String())
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	data := map[string]any{
+		"name":     "fingerprint",
+		"callback": func() {},
+	}
+
+	f := Listener()
+	f.Strict = true
+	_, err := f.Store(data)
+	var unsupported *UnsupportedError
+	if !errors.As(err, &unsupported) || unsupported.Path != "callback" || unsupported.Kind != reflect.Func {
+		t.Fatalf("expected an UnsupportedError for callback, got %v", err)
+	}
+
+	f = Listener()
+	f.Fallback = func(path string, v reflect.Value) (any, error) {
+		return v.Kind().String(), nil
+	}
+	res, err := f.Store(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.(map[string]any)["callback"] != "func" {
+		t.Errorf("expected the fallback encoder to be used, got %v", res)
+	}
+
+	// input the fallback handles cannot be measured, it is stored anyway
+	f.CollectStats = true
+	if _, err := f.Store(data); err != nil {
+		t.Fatal(err)
+	}
+	if f.Stats().Calls != 0 {
+		t.Errorf("expected the call not to be measured, got %v", f.Stats())
+	}
+}
+
+func TestStorePointers(t *testing.T) {
+	f := Listener()
+	f.Threshhold = 5
+	m := map[string]any{"name": "fingerprint"}
+	res, err := f.Store(&m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := f.Restore(res); !reflect.DeepEqual(normalize(got), m) {
+		t.Errorf("restored %v, want %v", got, m)
+	}
+	if res, err := f.Store([2]string{"fingerprint", "a"}); err != nil || !reflect.DeepEqual(res, []any{"h_0", "a"}) {
+		t.Errorf("got %v, %v", res, err)
+	}
+
+	for _, data := range []any{(*map[string]any)(nil), (*unexportedString)(nil), (*Object)(nil)} {
+		if _, err := f.Store(data); err == nil {
+			t.Errorf("expected an error for %T", data)
+		}
+	}
+}
+
+type unexportedString struct {
+	Name     string `json:"name"`
+	platform string
+}
+
+type unexportedFunc struct {
+	Name     string `json:"name"`
+	callback func()
+}
+
+func TestUnexported(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		f := Listener()
+		f.Threshhold = 20
+		f.Strict = strict
+
+		// unexported fields cannot have a json tag, so they are stored
+		// under the empty name, like untagged exported fields
+		res, err := f.Store(unexportedString{Name: "fingerprint", platform: "macOS"})
+		if err != nil {
+			t.Fatalf("strict %v: %v", strict, err)
+		}
+		if want := map[string]any{"name": "fingerprint", "": "macOS"}; !reflect.DeepEqual(res, want) {
+			t.Errorf("strict %v: got %v, want %v", strict, res, want)
+		}
+
+		res, err = f.Store(unexportedFunc{Name: "fingerprint", callback: func() {}})
+		if err != nil {
+			t.Fatalf("strict %v: %v", strict, err)
+		}
+		if want := map[string]any{"name": "fingerprint"}; !reflect.DeepEqual(res, want) {
+			t.Errorf("strict %v: got %v, want %v", strict, res, want)
+		}
+	}
+}
+
+func BenchmarkStoreStruct(b *testing.B) {
+	var data ExampleStruct
+	if err := json.Unmarshal(fp, &data); err != nil {
+		b.Fatal(err)
+	}
+	f := Listener()
+	f.Threshhold = 5
+	f.UseKeyCompression = true
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := f.Store(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestGenerated(t *testing.T) {
+	var data ExampleStruct
+	if err := json.Unmarshal(fp, &data); err != nil {
+		t.Fatal(err)
+	}
+	f := Listener()
+	f.Threshhold = 5
+	f.UseKeyCompression = true
+
+	want, err := f.Store(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := CompactExampleStruct(f, &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("generated compactor differs from Store:\n%v\n%v", got, want)
+	}
+
+	var restored ExampleStruct
+	if err := RestoreExampleStruct(f, got, &restored); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(restored, data) {
+		t.Errorf("restored %+v, want %+v", restored, data)
+	}
+}
+
+func BenchmarkCompactExampleStruct(b *testing.B) {
+	var data ExampleStruct
+	if err := json.Unmarshal(fp, &data); err != nil {
+		b.Fatal(err)
+	}
+	f := Listener()
+	f.Threshhold = 5
+	f.UseKeyCompression = true
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := CompactExampleStruct(f, &data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	store := func() (string, string) {
+		var data map[string]any
+		if err := json.Unmarshal(fp2, &data); err != nil {
+			t.Fatal(err)
+		}
+		f := Listener()
+		f.Threshhold = 5
+		f.UseKeyCompression = true
+		res, err := f.Store(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := json.Marshal(res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var dict bytes.Buffer
+		if _, err := f.database.WriteTo(&dict); err != nil {
+			t.Fatal(err)
+		}
+		return string(out), dict.String()
+	}
+
+	out, dict := store()
+	for i := 0; i < 5; i++ {
+		again, againDict := store()
+		if again != out || againDict != dict {
+			t.Fatal("storing the same data in fresh listeners gave different results")
+		}
+	}
+}
+
+func TestLiteralIDs(t *testing.T) {
+	f := Listener()
+	f.Threshhold = 5
+
+	// "h_0" is kept verbatim, but also the id of the first hashed value
+	in := map[string]any{"a": "h_0", "b": "~h_0", "c": "a longer value", "d": "~x"}
+	res, err := f.Store(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := f.Database().IDOf("a longer value"); id != "h_0" {
+		t.Fatalf("expected the long value to get h_0, got %q", id)
+	}
+	out, err := f.Restore(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("restored %v, want %v", out, in)
+	}
+
+	if _, err := f.Put(in); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{"h_0", "~h_0", "a longer value"} {
+		got, err := f.Query(Eq("a", v))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := v == "h_0"; (len(got) == 1) != want {
+			t.Errorf("query for a = %q found %v", v, got)
+		}
+	}
+}
+
+func TestPlanKeys(t *testing.T) {
+	type record struct {
+		Empty string `json:"empty"`
+		Name  string `json:"name"`
+	}
+	f := Listener()
+	f.Threshhold = 5
+	f.UseKeyCompression = true
+	for i := 0; i < 2; i++ {
+		if _, err := f.Store(record{Name: "fingerprint"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	keys := f.Database().Entries(KeyEntry)
+	if len(keys) != 1 || keys[0].ID != "h_0" || keys[0].Value != "name" {
+		t.Fatalf("expected only the stored key, got %+v", keys)
+	}
+	if keys[0].Refs != 2 {
+		t.Errorf("expected 2 references to the key, got %d", keys[0].Refs)
+	}
+
+	// the plan of the same type must not be shared with other settings
+	f.UseKeyCompression = false
+	res, err := f.Store(record{Name: "fingerprint"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := res.(map[string]any)["name"]; !ok {
+		t.Errorf("expected the key to be stored as is, got %v", res)
+	}
+	f.DontHash = []string{"name"}
+	f.Threshhold = 100
+	res, err = f.Store(record{Name: "fingerprint"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := res.(map[string]any)["name"]; v != "h_0" {
+		t.Errorf("expected DontHash to apply, got %v", v)
+	}
+}
+
+func TestIntMapKeys(t *testing.T) {
+	f := Listener()
+	res, err := f.Store(map[int]string{10: "ten", 2: "two", 1: "one"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{"1": "h_0", "10": "h_1", "2": "h_2"}
+	if !reflect.DeepEqual(res, want) {
+		t.Errorf("got %v, want %v", res, want)
+	}
+}
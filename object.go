@@ -0,0 +1,169 @@
+package fstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+
+	"golang.org/x/exp/slices"
+)
+
+// Object is a JSON object that keeps the order of its keys. DecodeJSON
+// produces it for every object, Store and Restore keep the order, and it
+// is marshaled with its keys in order.
+type Object struct {
+	Keys   []string
+	Values map[string]any
+}
+
+var objectType = reflect.TypeOf(&Object{})
+
+func NewObject() *Object {
+	return &Object{Values: map[string]any{}}
+}
+
+// Set sets the value of key, appending the key if it is new.
+func (o *Object) Set(key string, v any) {
+	if _, ok := o.Values[key]; !ok {
+		o.Keys = append(o.Keys, key)
+	}
+	o.Values[key] = v
+}
+
+// Get returns the value of key.
+func (o *Object) Get(key string) (any, bool) {
+	v, ok := o.Values[key]
+	return v, ok
+}
+
+// remove deletes key and its value.
+func (o *Object) remove(key string) {
+	if _, ok := o.Values[key]; !ok {
+		return
+	}
+	delete(o.Values, key)
+	for i, k := range o.Keys {
+		if k == key {
+			o.Keys = append(o.Keys[:i], o.Keys[i+1:]...)
+			break
+		}
+	}
+}
+
+func (o *Object) Len() int {
+	return len(o.Keys)
+}
+
+func (o *Object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range o.Keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		val, err := json.Marshal(o.Values[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(val)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func (o *Object) UnmarshalJSON(b []byte) error {
+	v, err := DecodeJSON(b)
+	if err != nil {
+		return err
+	}
+	obj, ok := v.(*Object)
+	if !ok {
+		return fmt.Errorf("could not unmarshal %T into an Object", v)
+	}
+	*o = *obj
+	return nil
+}
+
+// DecodeJSON decodes a JSON document like json.Unmarshal into an any would,
+// but decodes objects into an *Object, so their key order is kept.
+func DecodeJSON(b []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	v, err := decodeOrdered(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return nil, errors.New("unexpected data after the JSON document")
+	}
+	return v, nil
+}
+
+func decodeOrdered(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		obj := NewObject()
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			v, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj.Set(key.(string), v)
+		}
+		_, err := dec.Token() // }
+		return obj, err
+	case json.Delim('['):
+		arr := []any{}
+		for dec.More() {
+			v, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		_, err := dec.Token() // ]
+		return arr, err
+	}
+	return tok, nil
+}
+
+// StoreJSON decodes a JSON document keeping the order of its keys and
+// stores it. The result contains an *Object for every object, so the
+// compacted JSON and the restored data keep the original order.
+func (s *StoreListener) StoreJSON(b []byte) (any, error) {
+	data, err := DecodeJSON(b)
+	if err != nil {
+		return nil, err
+	}
+	return s.Store(data)
+}
+
+func (s *StoreListener) getObjectValue(obj *Object, path string) (any, error) {
+	result := s.NewFieldSet()
+	result.ordered = true
+	for _, name := range obj.Keys {
+		val, err := s.getFieldValue(reflect.ValueOf(obj.Values[name]), slices.Contains(s.DontHash, name), joinPath(path, name))
+		if err != nil {
+			return nil, err
+		}
+		result.Set(name, val)
+	}
+	return result.Value(), nil
+}
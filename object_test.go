@@ -0,0 +1,98 @@
+package fstore
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestKeyOrder(t *testing.T) {
+	in := `{"z":1,"permissions":{"notifications":"prompt","geolocation":"denied","camera":"granted"},"a":["Mozilla/5.0"]}`
+
+	f := Listener()
+	f.Threshhold = 5
+	f.UseKeyCompression = true
+	res, err := f.StoreJSON([]byte(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	compacted, err := json.Marshal(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := DecodeJSON(compacted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err := f.Restore(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := json.Marshal(restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != in {
+		t.Errorf("got %s, want %s", out, in)
+	}
+}
+
+func TestKeyOrderFingerprint(t *testing.T) {
+	f := Listener()
+	f.Threshhold = 5
+	res, err := f.StoreJSON(fp2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err := f.Restore(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	orig, err := DecodeJSON(fp2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// empty values are left out, the remaining keys have to keep their order
+	var keys []string
+	for _, k := range orig.(*Object).Keys {
+		if _, ok := restored.(*Object).Get(k); ok {
+			keys = append(keys, k)
+		}
+	}
+	if got := restored.(*Object).Keys; !reflect.DeepEqual(got, keys) {
+		t.Errorf("got keys %v, want %v", got, keys)
+	}
+}
+
+func TestDontHashInputs(t *testing.T) {
+	in := `{"ua":"abc","cores":8}`
+	var m map[string]any
+	if err := json.Unmarshal([]byte(in), &m); err != nil {
+		t.Fatal(err)
+	}
+	type record struct {
+		UA    string  `json:"ua"`
+		Cores float64 `json:"cores"`
+	}
+	for name, store := range map[string]func(f *StoreListener) (any, error){
+		"map":    func(f *StoreListener) (any, error) { return f.Store(m) },
+		"json":   func(f *StoreListener) (any, error) { return f.StoreJSON([]byte(in)) },
+		"struct": func(f *StoreListener) (any, error) { return f.Store(record{UA: "abc", Cores: 8}) },
+	} {
+		f := Listener()
+		f.Threshhold = 5
+		f.DontHash = []string{"ua", "cores"}
+		res, err := store(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := normalize(res).(map[string]any)
+		ua, _ := got["ua"].(string)
+		cores, _ := got["cores"].(string)
+		if f.Database().Len() != 2 || !IsRef(ua) || !IsRef(cores) {
+			t.Errorf("%s: expected both values to be hashed, got %v", name, got)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package fstore
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"sync"
+)
+
+type batchJob struct {
+	seq  int
+	line int
+	data []byte
+}
+
+type batchResult struct {
+	seq   int
+	line  int
+	data  any // decoded line, for stats
+	res   any
+	local Database
+	err   error
+}
+
+// StoreBatchParallel works like StoreBatch, but compacts lines on the given
+// number of goroutines. Output keeps the input order, and dictionary ids
+// only depend on the input, not on how the lines were scheduled.
+//
+// Workers compact every line against a private dictionary. The calling
+// goroutine then merges those into the shared dictionary in input order,
+// visiting keys in the same order Store does, so the result matches
+// StoreBatch byte for byte. With CollectStats, every line is measured
+// against the shared dictionary after the merge.
+//
+// Workers share the Fallback encoder, the codecs and the logger, so those
+// must be safe for concurrent use.
+func (s *StoreListener) StoreBatchParallel(r io.Reader, records io.Writer, dict io.Writer, workers int) (BatchReport, error) {
+	if workers < 1 {
+		workers = 1
+	}
+	var report BatchReport
+	out := bufio.NewWriter(records)
+	if s.UseKeyCompression {
+		s.database.compressedKeys = true
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	// limits the lines in flight, so a slow line cannot make the reorder
+	// buffer grow without bounds
+	inflight := make(chan struct{}, workers*4)
+	jobs := make(chan batchJob, workers)
+	results := make(chan batchResult, workers)
+	readErr := make(chan error, 1)
+
+	go func() {
+		defer close(jobs)
+		readErr <- readLines(r, done, inflight, jobs)
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := s.worker()
+			for job := range jobs {
+				select {
+				case results <- w.compactJob(job):
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	pending := map[int]batchResult{}
+	next := 0
+	for res := range results {
+		pending[res.seq] = res
+		for {
+			res, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			<-inflight
+
+			report.Lines++
+			b, err := s.mergeResult(res)
+			if err != nil {
+				report.Errors = append(report.Errors, &LineError{Line: res.line, Err: err})
+				b = []byte("null")
+			} else {
+				report.Stored++
+			}
+			if _, err := out.Write(append(b, '\n')); err != nil {
+				return report, err
+			}
+		}
+	}
+	if err := <-readErr; err != nil {
+		return report, err
+	}
+
+	if err := out.Flush(); err != nil {
+		return report, err
+	}
+	if dict != nil {
+		if _, err := s.database.WriteTo(dict); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// readLines sends the non-empty lines of r to jobs.
+func readLines(r io.Reader, done <-chan struct{}, inflight chan<- struct{}, jobs chan<- batchJob) error {
+	in := bufio.NewReader(r)
+	seq := 0
+	for line := 1; ; line++ {
+		b, err := in.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		if len(bytes.TrimSpace(b)) > 0 {
+			select {
+			case inflight <- struct{}{}:
+			case <-done:
+				return nil
+			}
+			select {
+			case jobs <- batchJob{seq: seq, line: line, data: b}:
+			case <-done:
+				return nil
+			}
+			seq++
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+	}
+}
+
+// worker returns a listener with the same settings as s, but its own
+// dictionary, for compacting on another goroutine.
+func (s *StoreListener) worker() *StoreListener {
+	return &StoreListener{
+		DontHash:          s.DontHash,
+		Threshhold:        s.Threshhold,
+		UseKeyCompression: s.UseKeyCompression,
+		UseShapes:         s.UseShapes,
+		Strict:            s.Strict,
+		Fallback:          s.Fallback,
+		logger:            s.logger,
+		codecs:            s.codecs,
+		database:          GetDatabase(),
+	}
+}
+
+func (s *StoreListener) compactJob(job batchJob) batchResult {
+	res := batchResult{seq: job.seq, line: job.line}
+
+	data, err := DecodeJSON(job.data)
+	if err != nil {
+		res.err = err
+		return res
+	}
+	// every line gets a fresh dictionary, so the merge only sees its ids.
+	// Plans are kept: decoded lines hold no structs, so no plan caches ids
+	// of an earlier line's dictionary.
+	s.database = GetDatabase()
+	res.data = data
+	res.res, res.err = s.store(data)
+	res.local = s.database
+	return res
+}
+
+// mergeResult moves the dictionary entries of a worker result into the
+// shared dictionary and returns the result as JSON.
+func (s *StoreListener) mergeResult(res batchResult) ([]byte, error) {
+	if res.err != nil {
+		return nil, res.err
+	}
+	before := s.database.counters
+	end := s.database.begin()
+	merged := s.merge(res.res, &res.local)
+	end()
+	if s.CollectStats {
+		s.collect(res.data, merged, before)
+	}
+	return json.Marshal(merged)
+}
+
+// merge rewrites the ids in v from the local dictionary to the ones of the
+// shared dictionary.
+func (s *StoreListener) merge(v any, local *Database) any {
+	switch v := v.(type) {
+	case *Shaped:
+		result := &Shaped{Values: make([]any, len(v.Values))}
+		for i, val := range v.Values {
+			result.Values[i] = s.merge(val, local)
+		}
+		result.Shape = s.database.SaveShape(local.shapes[v.Shape])
+		return result
+	case *Object:
+		result := NewObject()
+		for _, k := range v.Keys {
+			val := s.merge(v.Values[k], local)
+			if s.UseKeyCompression {
+				k = s.database.SaveKey(local.hashKeys[k])
+			}
+			result.Set(k, val)
+		}
+		return result
+	case map[string]any:
+		// sort by the original keys, local ids depend on the walk order
+		names := make(map[string]string, len(v))
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			names[k] = k
+			if s.UseKeyCompression {
+				names[k] = local.hashKeys[k]
+			}
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return names[keys[i]] < names[keys[j]]
+		})
+
+		result := make(map[string]any, len(v))
+		for _, k := range keys {
+			val := s.merge(v[k], local)
+			if s.UseKeyCompression {
+				k = s.database.SaveKey(names[k])
+			}
+			result[k] = val
+		}
+		return result
+	case []any:
+		result := make([]any, len(v))
+		for i, val := range v {
+			result[i] = s.merge(val, local)
+		}
+		return result
+	case string:
+		if orig, ok := local.hashValues[v]; ok && IsRef(v) {
+			return s.database.SaveHash(orig)
+		}
+	}
+	return v
+}
@@ -0,0 +1,178 @@
+package fstore
+
+import "fmt"
+
+// leaves flattens compacted data into path -> value. Values are dictionary
+// ids or short literals, so comparing them is cheap.
+func (s *StoreListener) leaves(data any) map[string]any {
+	out := map[string]any{}
+	s.walkLeaves(data, "", func(path string, v any) {
+		out[path] = v
+	})
+	return out
+}
+
+// walkLeaves calls fn for every scalar in compacted data, with its path
+// like "tls.extensions[3].name". Compressed keys and shapes are resolved,
+// so paths use the original key names.
+func (s *StoreListener) walkLeaves(data any, path string, fn func(path string, v any)) {
+	if r, ok := data.(resolved); ok {
+		walkNamed(r.data, path, fn)
+		return
+	}
+	if sh, ok := asShaped(data); ok {
+		keys := s.database.shapes[sh.Shape]
+		for i, v := range sh.Values {
+			if i < len(keys) {
+				s.walkLeaves(v, joinPath(path, keys[i]), fn)
+			}
+		}
+		return
+	}
+	if keys, fields, ok := objectFields(data); ok {
+		for _, k := range keys {
+			name, err := s.restoreKey(k)
+			if err != nil {
+				name = k
+			}
+			s.walkLeaves(fields[k], joinPath(path, name), fn)
+		}
+		return
+	}
+	if arr, ok := data.([]any); ok {
+		for i, v := range arr {
+			s.walkLeaves(v, indexPath(path, i), fn)
+		}
+		return
+	}
+	fn(path, data)
+}
+
+// resolved is compacted data whose keys and shapes are already resolved
+// to key names. compactedFull returns it for deltas.
+type resolved struct {
+	data any
+}
+
+// walkNamed works like walkLeaves for the data of a resolved.
+func walkNamed(data any, path string, fn func(path string, v any)) {
+	if keys, fields, ok := objectFields(data); ok {
+		for _, k := range keys {
+			walkNamed(fields[k], joinPath(path, k), fn)
+		}
+		return
+	}
+	if arr, ok := data.([]any); ok {
+		for i, v := range arr {
+			walkNamed(v, indexPath(path, i), fn)
+		}
+		return
+	}
+	fn(path, data)
+}
+
+// compactedFull returns a stored record as compacted data for walkLeaves,
+// resolving deltas. The patch is applied to the compacted base, so values
+// stay dictionary ids and the dictionary is left untouched.
+func (s *StoreListener) compactedFull(rec any) (any, error) {
+	d, ok := asDelta(rec)
+	if !ok {
+		return rec, nil
+	}
+	baseRec, ok := s.records.records[d.Base]
+	if !ok {
+		return nil, fmt.Errorf("could not resolve delta: record %d: %w", d.Base, ErrNotFound)
+	}
+	base, err := s.compactedFull(baseRec)
+	if err != nil {
+		return nil, err
+	}
+	named, err := s.named(base)
+	if err != nil {
+		return nil, err
+	}
+	patch, err := s.named(d.Patch)
+	if err != nil {
+		return nil, err
+	}
+	return resolved{mergePatch(named, patch)}, nil
+}
+
+// named replaces the compressed keys and shapes in compacted data by *Object
+// values with the key names. Values are left as they are.
+func (s *StoreListener) named(data any) (any, error) {
+	if r, ok := data.(resolved); ok {
+		return r.data, nil
+	}
+	if sh, ok := asShaped(data); ok {
+		keys, ok := s.database.shapes[sh.Shape]
+		if !ok {
+			return nil, fmt.Errorf("unknown shape %q", sh.Shape)
+		}
+		if len(keys) != len(sh.Values) {
+			return nil, fmt.Errorf("shape %q has %d keys, got %d values", sh.Shape, len(keys), len(sh.Values))
+		}
+		obj := NewObject()
+		for i, k := range keys {
+			v, err := s.named(sh.Values[i])
+			if err != nil {
+				return nil, err
+			}
+			obj.Set(k, v)
+		}
+		return obj, nil
+	}
+	if keys, fields, ok := objectFields(data); ok {
+		obj := NewObject()
+		for _, k := range keys {
+			name, err := s.restoreKey(k)
+			if err != nil {
+				return nil, err
+			}
+			v, err := s.named(fields[k])
+			if err != nil {
+				return nil, err
+			}
+			obj.Set(name, v)
+		}
+		return obj, nil
+	}
+	if arr, ok := data.([]any); ok {
+		res := make([]any, len(arr))
+		for i, e := range arr {
+			v, err := s.named(e)
+			if err != nil {
+				return nil, err
+			}
+			res[i] = v
+		}
+		return res, nil
+	}
+	return data, nil
+}
+
+// unnamed turns data returned by named back into a stored record, the way
+// Store builds objects: keys go through the dictionary again, and objects
+// become shapes with UseShapes. Values are already compacted, their ids
+// are counted as used.
+func (s *StoreListener) unnamed(data any) any {
+	if keys, fields, ok := objectFields(data); ok {
+		f := s.NewFieldSet()
+		_, f.ordered = data.(*Object)
+		for _, k := range keys {
+			f.Set(k, s.unnamed(fields[k]))
+		}
+		return f.Value()
+	}
+	if arr, ok := data.([]any); ok {
+		res := make([]any, len(arr))
+		for i, e := range arr {
+			res[i] = s.unnamed(e)
+		}
+		return res
+	}
+	if str, ok := data.(string); ok && IsRef(str) {
+		s.database.reuse(ValueEntry, str)
+	}
+	return data
+}
@@ -0,0 +1,86 @@
+package fstore
+
+import (
+	"reflect"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// structPlan is the compiled metadata of a struct type, so getStructValue
+// does not have to parse tags and look up keys for every value.
+type structPlan struct {
+	fields []fieldPlan
+}
+
+type fieldPlan struct {
+	index    int
+	name     string // stored name, taken from the json tag
+	dontHash bool   // name is listed in DontHash
+	key      string // key id, resolved when the field is first stored
+}
+
+// planKey identifies a plan: the same type compiles differently depending
+// on the key compression and hashing policy.
+type planKey struct {
+	t                 reflect.Type
+	useKeyCompression bool
+	dontHash          string
+}
+
+// noCodec marks types without a codec in the codec cache.
+type noCodec struct{ Codec }
+
+// planFor returns the cached plan for the struct type t, compiling it on
+// first use. Plans are cached per listener, because the hashing policy and
+// key ids depend on its settings and dictionary.
+func (s *StoreListener) planFor(t reflect.Type) *structPlan {
+	key := planKey{t, s.UseKeyCompression, strings.Join(s.DontHash, "\x00")}
+	if p, ok := s.plans.Load(key); ok {
+		return p.(*structPlan)
+	}
+
+	p := &structPlan{fields: make([]fieldPlan, t.NumField())}
+	for i := range p.fields {
+		f := t.Field(i)
+		name := fieldName(f)
+		p.fields[i] = fieldPlan{
+			index:    i,
+			name:     name,
+			dontHash: slices.Contains(s.DontHash, name),
+		}
+	}
+	actual, _ := s.plans.LoadOrStore(key, p)
+	return actual.(*structPlan)
+}
+
+// cachedCodecFor works like codecFor, but remembers the result per type.
+func (s *StoreListener) cachedCodecFor(t reflect.Type) Codec {
+	if c, ok := s.typeCodecs.Load(t); ok {
+		if _, none := c.(noCodec); none {
+			return nil
+		}
+		return c.(Codec)
+	}
+
+	c := s.codecFor(t)
+	if c == nil {
+		s.typeCodecs.Store(t, noCodec{})
+	} else {
+		s.typeCodecs.Store(t, c)
+	}
+	return c
+}
+
+// resetPlans drops all cached plans and codecs, e.g. after a new codec was
+// registered.
+func (s *StoreListener) resetPlans() {
+	s.plans.Range(func(k, _ any) bool {
+		s.plans.Delete(k)
+		return true
+	})
+	s.typeCodecs.Range(func(k, _ any) bool {
+		s.typeCodecs.Delete(k)
+		return true
+	})
+}
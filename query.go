@@ -0,0 +1,228 @@
+package fstore
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Predicate is a condition on the value at a path of a record, see Query.
+// Paths look like "tls.ja3_hash" or "tls.extensions[2].name"; "[*]" matches
+// any array index.
+type Predicate struct {
+	Path string
+	op   queryOp
+	vals []any
+	min  any
+	max  any
+}
+
+type queryOp int
+
+const (
+	opEq queryOp = iota
+	opIn
+	opRange
+	opExists
+)
+
+// Eq matches records whose value at path equals v.
+func Eq(path string, v any) Predicate {
+	return Predicate{Path: path, op: opEq, vals: []any{v}}
+}
+
+// In matches records whose value at path equals one of vs.
+func In(path string, vs ...any) Predicate {
+	return Predicate{Path: path, op: opIn, vals: vs}
+}
+
+// Range matches records whose value at path is between min and max,
+// inclusive. A nil bound is open. Numbers are compared as numbers, strings
+// lexicographically.
+func Range(path string, min, max any) Predicate {
+	return Predicate{Path: path, op: opRange, min: min, max: max}
+}
+
+// Exists matches records that have a value at path, or below it.
+func Exists(path string) Predicate {
+	return Predicate{Path: path, op: opExists}
+}
+
+var arrayIndex = regexp.MustCompile(`\[\d+\]`)
+
+// compiledPredicate is a predicate with its literals translated to the
+// compacted values they are stored as.
+type compiledPredicate struct {
+	Predicate
+	wildcard bool
+	strs     map[string]bool // compacted strings, raw or dictionary ids
+	nums     []float64
+	null     bool
+}
+
+func (s *StoreListener) compile(p Predicate) compiledPredicate {
+	c := compiledPredicate{
+		Predicate: p,
+		wildcard:  strings.Contains(p.Path, "[*]"),
+		strs:      map[string]bool{},
+	}
+	for _, v := range p.vals {
+		if str, ok := v.(string); ok {
+			// short strings are stored as they are, others as ids
+			c.strs[EscapeLiteral(str)] = true
+			if id, ok := s.database.valueIDs[str]; ok {
+				c.strs[id] = true
+			}
+			continue
+		}
+		if f, ok := toFloat(v); ok {
+			c.nums = append(c.nums, f)
+			// numbers listed in DontHash are stored as ids
+			if id, ok := s.database.valueIDs[fmt.Sprintf("%v", v)]; ok {
+				c.strs[id] = true
+			}
+			continue
+		}
+		if v == nil {
+			c.null = true
+		}
+	}
+	return c
+}
+
+// matchesPath reports whether the leaf at path is the predicate's path, or
+// below it for Exists.
+func (c *compiledPredicate) matchesPath(path string) bool {
+	if c.wildcard {
+		path = arrayIndex.ReplaceAllString(path, "[*]")
+	}
+	if path == c.Path {
+		return true
+	}
+	if c.op != opExists || !strings.HasPrefix(path, c.Path) {
+		return false
+	}
+	rest := path[len(c.Path):]
+	return strings.HasPrefix(rest, ".") || strings.HasPrefix(rest, "[")
+}
+
+// matches reports whether a compacted leaf value satisfies the predicate.
+func (s *StoreListener) matches(c *compiledPredicate, v any) bool {
+	switch c.op {
+	case opExists:
+		return true
+	case opEq, opIn:
+		if v == nil {
+			return c.null
+		}
+		if str, ok := v.(string); ok {
+			return c.strs[str]
+		}
+		if f, ok := toFloat(v); ok {
+			for _, n := range c.nums {
+				if n == f {
+					return true
+				}
+			}
+		}
+		if b, ok := v.(bool); ok {
+			for _, w := range c.vals {
+				if w == b {
+					return true
+				}
+			}
+		}
+		return false
+	case opRange:
+		return s.inRange(c, v)
+	}
+	return false
+}
+
+func (s *StoreListener) inRange(c *compiledPredicate, v any) bool {
+	if str, ok := v.(string); ok {
+		// only range queries need the value behind an id
+		if val, ok := s.database.hashValues[str]; ok && IsRef(str) {
+			v = val
+		} else {
+			v = UnescapeLiteral(str)
+		}
+	}
+
+	if (c.min == nil || isNumber(c.min)) && (c.max == nil || isNumber(c.max)) {
+		f, ok := toFloat(v)
+		if !ok {
+			return false
+		}
+		min, _ := toFloat(c.min)
+		max, _ := toFloat(c.max)
+		return (c.min == nil || f >= min) && (c.max == nil || f <= max)
+	}
+
+	str, ok := v.(string)
+	if !ok {
+		return false
+	}
+	min, minOK := c.min.(string)
+	max, maxOK := c.max.(string)
+	return (c.min == nil || minOK && str >= min) && (c.max == nil || maxOK && str <= max)
+}
+
+func isNumber(v any) bool {
+	switch v.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return true
+	}
+	return false
+}
+
+// Query returns the ids of the stored records matching all predicates, in
+// ascending order. Literals are translated to dictionary ids once, so
+// records are matched in their compacted form without restoring them.
+// Eq and In predicates on indexed paths narrow down the records to match,
+// see AddIndex.
+func (s *StoreListener) Query(preds ...Predicate) ([]RecordID, error) {
+	compiled := make([]compiledPredicate, len(preds))
+	for i, p := range preds {
+		compiled[i] = s.compile(p)
+	}
+
+	ids := s.RecordIDs()
+	if bm, ok := s.candidates(compiled); ok {
+		ids = toRecordIDs(bm)
+	}
+
+	var result []RecordID
+	for _, id := range ids {
+		ok, err := s.matchRecord(id, compiled)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			result = append(result, id)
+		}
+	}
+	return result, nil
+}
+
+func (s *StoreListener) matchRecord(id RecordID, preds []compiledPredicate) (bool, error) {
+	rec, err := s.compactedFull(s.records.records[id])
+	if err != nil {
+		return false, fmt.Errorf("record %d: %w", id, err)
+	}
+
+	satisfied := make([]bool, len(preds))
+	s.walkLeaves(rec, "", func(path string, v any) {
+		for i := range preds {
+			if !satisfied[i] && preds[i].matchesPath(path) && s.matches(&preds[i], v) {
+				satisfied[i] = true
+			}
+		}
+	})
+	for _, ok := range satisfied {
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,55 @@
+package fstore
+
+import (
+	"reflect"
+	"testing"
+)
+
+func queryListener(t *testing.T) *StoreListener {
+	f := Listener()
+	f.Threshhold = 5
+	f.UseKeyCompression = true
+
+	records := []map[string]any{
+		{"tls": map[string]any{"ja3_hash": "aaa111aaa111"}, "HighEntropyValues": map[string]any{"platform": "macOS"}, "hardwareConcurrency": 8.0, "languages": []any{"en-US", "de-DE"}},
+		{"tls": map[string]any{"ja3_hash": "aaa111aaa111"}, "HighEntropyValues": map[string]any{"platform": "Windows"}, "hardwareConcurrency": 16.0},
+		{"tls": map[string]any{"ja3_hash": "bbb222bbb222"}, "HighEntropyValues": map[string]any{"platform": "macOS"}, "hardwareConcurrency": 4.0, "languages": []any{"fr-FR"}},
+		{"tls": map[string]any{"ja3_hash": "aaa111aaa111"}, "HighEntropyValues": map[string]any{"platform": "macOS"}, "hardwareConcurrency": 12.0},
+	}
+	for _, r := range records {
+		if _, err := f.Put(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return f
+}
+
+func TestQuery(t *testing.T) {
+	f := queryListener(t)
+
+	tests := []struct {
+		name  string
+		preds []Predicate
+		want  []RecordID
+	}{
+		{"eq", []Predicate{Eq("tls.ja3_hash", "aaa111aaa111"), Eq("HighEntropyValues.platform", "macOS")}, []RecordID{0, 3}},
+		{"in", []Predicate{In("HighEntropyValues.platform", "Windows", "Linux")}, []RecordID{1}},
+		{"range", []Predicate{Range("hardwareConcurrency", 8, 12)}, []RecordID{0, 3}},
+		{"open range", []Predicate{Range("hardwareConcurrency", nil, 8)}, []RecordID{0, 2}},
+		{"string range", []Predicate{Range("HighEntropyValues.platform", "W", "X")}, []RecordID{1}},
+		{"exists", []Predicate{Exists("languages")}, []RecordID{0, 2}},
+		{"wildcard", []Predicate{Eq("languages[*]", "de-DE")}, []RecordID{0}},
+		{"unknown value", []Predicate{Eq("tls.ja3_hash", "ccc333ccc333")}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := f.Query(tt.preds...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package fstore
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// RecordID identifies a record kept by the listener, see Put.
+type RecordID int
+
+// ErrNotFound is returned for records that do not exist.
+var ErrNotFound = errors.New("record not found")
+
+// recordStore keeps compacted records and the deltas stored against them.
+type recordStore struct {
+	records map[RecordID]any // compacted data or *Delta
+	next    RecordID
+	bases   map[RecordID]int // number of deltas stored against a record
+}
+
+func newRecordStore() recordStore {
+	return recordStore{
+		records: map[RecordID]any{},
+		bases:   map[RecordID]int{},
+	}
+}
+
+// Put stores data and keeps the compacted result as a record.
+func (s *StoreListener) Put(data any) (RecordID, error) {
+	res, err := s.Store(data)
+	if err != nil {
+		return 0, err
+	}
+	return s.addRecord(res)
+}
+
+func (s *StoreListener) addRecord(res any) (RecordID, error) {
+	id := s.records.next
+	if err := s.indexRecord(id, res, true); err != nil {
+		return 0, err
+	}
+	s.records.next++
+	s.records.records[id] = res
+	if d, ok := res.(*Delta); ok {
+		s.records.bases[d.Base]++
+	}
+	return id, nil
+}
+
+// Get returns the restored data of a record.
+func (s *StoreListener) Get(id RecordID) (any, error) {
+	rec, ok := s.records.records[id]
+	if !ok {
+		return nil, fmt.Errorf("record %d: %w", id, ErrNotFound)
+	}
+	return s.Restore(rec)
+}
+
+// Compacted returns the record as it is stored, compacted data or a *Delta.
+func (s *StoreListener) Compacted(id RecordID) (any, bool) {
+	rec, ok := s.records.records[id]
+	return rec, ok
+}
+
+// Delete removes a record. Records other records are stored against as
+// deltas cannot be removed.
+func (s *StoreListener) Delete(id RecordID) error {
+	rec, ok := s.records.records[id]
+	if !ok {
+		return fmt.Errorf("record %d: %w", id, ErrNotFound)
+	}
+	if n := s.records.bases[id]; n > 0 {
+		return fmt.Errorf("record %d is the base of %d deltas", id, n)
+	}
+	if err := s.indexRecord(id, rec, false); err != nil {
+		return err
+	}
+	if d, ok := rec.(*Delta); ok {
+		s.records.bases[d.Base]--
+	}
+	delete(s.records.records, id)
+	delete(s.records.bases, id)
+	s.dropPrototype(id)
+	return nil
+}
+
+// RecordIDs returns the ids of all records, in ascending order.
+func (s *StoreListener) RecordIDs() []RecordID {
+	ids := make([]RecordID, 0, len(s.records.records))
+	for id := range s.records.records {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
@@ -0,0 +1,299 @@
+package fstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// Restore expands the dictionary references in data, a result of Store,
+// back into the original values.
+func (s *StoreListener) Restore(data any) (any, error) {
+	if v, ok := asVersioned(data); ok {
+		if err := s.checkVersion(v.Version); err != nil {
+			return nil, err
+		}
+		return s.Restore(v.Record)
+	}
+	if sh, ok := asShaped(data); ok {
+		return s.restoreShaped(sh)
+	}
+	if d, ok := asDelta(data); ok {
+		return s.restoreDelta(d)
+	}
+	switch v := data.(type) {
+	case *Object:
+		result := NewObject()
+		for _, k := range v.Keys {
+			name, err := s.restoreKey(k)
+			if err != nil {
+				return nil, err
+			}
+			r, err := s.Restore(v.Values[k])
+			if err != nil {
+				return nil, err
+			}
+			result.Set(name, r)
+		}
+		return result, nil
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for k, val := range v {
+			name, err := s.restoreKey(k)
+			if err != nil {
+				return nil, err
+			}
+			r, err := s.Restore(val)
+			if err != nil {
+				return nil, err
+			}
+			result[name] = r
+		}
+		return result, nil
+	case []any:
+		result := make([]any, len(v))
+		for i, val := range v {
+			r, err := s.Restore(val)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = r
+		}
+		return result, nil
+	case string:
+		if !IsRef(v) {
+			return UnescapeLiteral(v), nil
+		}
+		if val, ok := s.database.hashValues[v]; ok {
+			return val, nil
+		}
+		return nil, fmt.Errorf("unknown value %q: %w", v, ErrMissingEntries)
+	}
+	return data, nil
+}
+
+func (s *StoreListener) restoreKey(k string) (string, error) {
+	if !s.UseKeyCompression {
+		return UnescapeKey(k), nil
+	}
+	name, ok := s.database.hashKeys[k]
+	if !ok {
+		return "", fmt.Errorf("unknown key %q: %w", k, ErrMissingEntries)
+	}
+	return name, nil
+}
+
+// RestoreInto restores data and stores the result in the value pointed to
+// by v, using the registered codecs.
+func (s *StoreListener) RestoreInto(data any, v any) error {
+	ref := reflect.ValueOf(v)
+	if ref.Kind() != reflect.Pointer || ref.IsNil() {
+		return fmt.Errorf("could not restore into %T, need a non-nil pointer", v)
+	}
+	res, err := s.Restore(data)
+	if err != nil {
+		return err
+	}
+	return s.decode(res, ref.Elem(), "")
+}
+
+func (s *StoreListener) decode(data any, dst reflect.Value, path string) error {
+	if data == nil {
+		return nil
+	}
+	if obj, ok := data.(*Object); ok && dst.Kind() != reflect.Interface {
+		data = obj.Values
+	}
+	if codec := s.codecFor(dst.Type()); codec != nil {
+		v, err := codec.Decode(data, dst.Type())
+		if err != nil {
+			return fmt.Errorf("could not decode %q: %w", path, err)
+		}
+		dst.Set(v)
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.Pointer:
+		v := reflect.New(dst.Type().Elem())
+		if err := s.decode(data, v.Elem(), path); err != nil {
+			return err
+		}
+		dst.Set(v)
+		return nil
+	case reflect.Interface:
+		v := reflect.ValueOf(data)
+		if !v.Type().AssignableTo(dst.Type()) {
+			break
+		}
+		dst.Set(v)
+		return nil
+	case reflect.Struct:
+		m, ok := data.(map[string]any)
+		if !ok {
+			break
+		}
+		for i := 0; i < dst.NumField(); i++ {
+			f := dst.Type().Field(i)
+			name := fieldName(f)
+			val, ok := m[name]
+			if !ok || !f.IsExported() {
+				continue
+			}
+			if err := s.decode(val, dst.Field(i), joinPath(path, name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		m, ok := data.(map[string]any)
+		if !ok || dst.Type().Key().Kind() != reflect.String {
+			break
+		}
+		res := reflect.MakeMapWithSize(dst.Type(), len(m))
+		for k, val := range m {
+			elem := reflect.New(dst.Type().Elem()).Elem()
+			if err := s.decode(val, elem, joinPath(path, k)); err != nil {
+				return err
+			}
+			res.SetMapIndex(reflect.ValueOf(k).Convert(dst.Type().Key()), elem)
+		}
+		dst.Set(res)
+		return nil
+	case reflect.Slice, reflect.Array:
+		items, ok := data.([]any)
+		if !ok {
+			break
+		}
+		if dst.Kind() == reflect.Slice {
+			dst.Set(reflect.MakeSlice(dst.Type(), len(items), len(items)))
+		}
+		for i := 0; i < len(items) && i < dst.Len(); i++ {
+			if err := s.decode(items[i], dst.Index(i), indexPath(path, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.String:
+		if str, ok := data.(string); ok {
+			dst.SetString(str)
+			return nil
+		}
+	case reflect.Bool:
+		if b, ok := data.(bool); ok {
+			dst.SetBool(b)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := toInt(data)
+		if !ok || dst.OverflowInt(i) {
+			break
+		}
+		dst.SetInt(i)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, ok := toUint(data)
+		if !ok || dst.OverflowUint(u) {
+			break
+		}
+		dst.SetUint(u)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, ok := toFloat(data)
+		if !ok {
+			break
+		}
+		dst.SetFloat(f)
+		return nil
+	}
+
+	return fmt.Errorf("could not decode %T into %s at %q", data, dst.Type(), path)
+}
+
+// toFloat converts restored numbers into a float64. Numbers stored via
+// DontHash come back as strings.
+func toFloat(data any) (float64, bool) {
+	switch v := data.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	rv := reflect.ValueOf(data)
+	switch {
+	case rv.CanInt():
+		return float64(rv.Int()), true
+	case rv.CanUint():
+		return float64(rv.Uint()), true
+	case rv.CanFloat():
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+// toInt converts restored numbers into an int64. Integers are converted
+// directly, not through float64, so values above 2^53 keep their value.
+func toInt(data any) (int64, bool) {
+	switch v := data.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, true
+		}
+	case string:
+		if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return i, true
+		}
+	}
+	rv := reflect.ValueOf(data)
+	switch {
+	case rv.CanInt():
+		return rv.Int(), true
+	case rv.CanUint():
+		u := rv.Uint()
+		return int64(u), u <= math.MaxInt64
+	}
+	f, ok := toFloat(data)
+	if !ok || f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+		return 0, false
+	}
+	return int64(f), true
+}
+
+// toUint works like toInt for unsigned integers.
+func toUint(data any) (uint64, bool) {
+	switch v := data.(type) {
+	case json.Number:
+		if u, err := strconv.ParseUint(v.String(), 10, 64); err == nil {
+			return u, true
+		}
+	case string:
+		if u, err := strconv.ParseUint(v, 10, 64); err == nil {
+			return u, true
+		}
+	}
+	rv := reflect.ValueOf(data)
+	switch {
+	case rv.CanUint():
+		return rv.Uint(), true
+	case rv.CanInt():
+		i := rv.Int()
+		return uint64(i), i >= 0
+	}
+	f, ok := toFloat(data)
+	if !ok || f != math.Trunc(f) || f < 0 || f >= math.MaxUint64 {
+		return 0, false
+	}
+	return uint64(f), true
+}
@@ -0,0 +1,390 @@
+package fstore
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// segmentMagic starts every segment written by WriteSegment.
+const segmentMagic = "FSEG1"
+
+// A segment stores a batch of compacted records column by column: every
+// path is a column holding its value for each record. Within a column, the
+// distinct values are kept once and the rows refer to them by code, with
+// runs of the same code run-length encoded and codes and run lengths
+// bit-packed. Code 0 marks rows without a value.
+//
+// Layout (integers are uvarints):
+//
+//	magic, rows, columns, columns x (path, offset, length), column blocks
+//	block: values, values x (json), runs, code width, length width,
+//	       packed codes, packed run lengths - 1
+
+// WriteSegment writes records, compacted data as returned by Store or
+// Compacted, as a columnar segment. Deltas are resolved into full records.
+func (s *StoreListener) WriteSegment(w io.Writer, records []any) error {
+	columns := map[string][]any{}
+	present := map[string][]bool{}
+	for row, rec := range records {
+		full, err := s.compactedFull(rec)
+		if err != nil {
+			return fmt.Errorf("record %d: %w", row, err)
+		}
+		s.walkLeaves(full, "", func(path string, v any) {
+			if _, ok := columns[path]; !ok {
+				columns[path] = make([]any, len(records))
+				present[path] = make([]bool, len(records))
+			}
+			columns[path][row] = v
+			present[path][row] = true
+		})
+	}
+
+	paths := make([]string, 0, len(columns))
+	for p := range columns {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	blocks := make([][]byte, len(paths))
+	for i, p := range paths {
+		b, err := encodeColumn(columns[p], present[p])
+		if err != nil {
+			return fmt.Errorf("column %q: %w", p, err)
+		}
+		blocks[i] = b
+	}
+
+	var header []byte
+	header = append(header, segmentMagic...)
+	header = binary.AppendUvarint(header, uint64(len(records)))
+	header = binary.AppendUvarint(header, uint64(len(paths)))
+	offset := 0
+	for i, p := range paths {
+		header = appendString(header, p)
+		header = binary.AppendUvarint(header, uint64(offset))
+		header = binary.AppendUvarint(header, uint64(len(blocks[i])))
+		offset += len(blocks[i])
+	}
+
+	bw := bufio.NewWriter(w)
+	if err := writeUvarint(bw, uint64(len(header))); err != nil {
+		return err
+	}
+	if _, err := bw.Write(header); err != nil {
+		return err
+	}
+	for _, b := range blocks {
+		if _, err := bw.Write(b); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func encodeColumn(values []any, present []bool) ([]byte, error) {
+	var table [][]byte
+	codes := map[string]uint64{}
+	rows := make([]uint64, len(values))
+	for i, v := range values {
+		if !present[i] {
+			continue
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		code, ok := codes[string(b)]
+		if !ok {
+			table = append(table, b)
+			code = uint64(len(table))
+			codes[string(b)] = code
+		}
+		rows[i] = code
+	}
+
+	var runCodes, runLengths []uint64
+	for i, code := range rows {
+		if i > 0 && runCodes[len(runCodes)-1] == code {
+			runLengths[len(runLengths)-1]++
+			continue
+		}
+		runCodes = append(runCodes, code)
+		runLengths = append(runLengths, 0) // stored as length - 1
+	}
+
+	var b []byte
+	b = binary.AppendUvarint(b, uint64(len(table)))
+	for _, v := range table {
+		b = appendString(b, string(v))
+	}
+	codeWidth, lengthWidth := bitWidth(runCodes), bitWidth(runLengths)
+	b = binary.AppendUvarint(b, uint64(len(runCodes)))
+	b = append(b, byte(codeWidth), byte(lengthWidth))
+	b = appendPacked(b, runCodes, codeWidth)
+	b = appendPacked(b, runLengths, lengthWidth)
+	return b, nil
+}
+
+// bitWidth returns the number of bits needed for the largest value.
+func bitWidth(values []uint64) int {
+	var max uint64
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	return bits.Len64(max)
+}
+
+// appendPacked appends values using width bits each, least significant bit
+// first, padded to a full byte.
+func appendPacked(b []byte, values []uint64, width int) []byte {
+	packed := make([]byte, (len(values)*width+7)/8)
+	pos := 0
+	for _, v := range values {
+		for i := 0; i < width; i++ {
+			if v&(1<<i) != 0 {
+				packed[pos/8] |= 1 << (pos % 8)
+			}
+			pos++
+		}
+	}
+	return append(b, packed...)
+}
+
+func unpack(b []byte, n, width int) ([]uint64, error) {
+	if len(b) < (n*width+7)/8 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	values := make([]uint64, n)
+	pos := 0
+	for j := range values {
+		for i := 0; i < width; i++ {
+			if b[pos/8]&(1<<(pos%8)) != 0 {
+				values[j] |= 1 << i
+			}
+			pos++
+		}
+	}
+	return values, nil
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func writeUvarint(w io.Writer, v uint64) error {
+	_, err := w.Write(binary.AppendUvarint(nil, v))
+	return err
+}
+
+// SegmentReader reads single columns of a segment, without decoding the
+// others.
+type SegmentReader struct {
+	r       io.ReaderAt
+	rows    int
+	paths   []string
+	columns map[string]columnRef
+	data    int64 // offset of the first column block
+}
+
+type columnRef struct {
+	offset, length int64
+}
+
+// OpenSegment reads the header of a segment written by WriteSegment.
+func OpenSegment(r io.ReaderAt) (*SegmentReader, error) {
+	var lenBuf [binary.MaxVarintLen64]byte
+	n, err := r.ReadAt(lenBuf[:], 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	headerLen, read := binary.Uvarint(lenBuf[:n])
+	if read <= 0 {
+		return nil, errors.New("invalid segment header")
+	}
+	header, err := readBlock(r, int64(read), headerLen)
+	if err != nil {
+		return nil, fmt.Errorf("could not read segment header: %w", err)
+	}
+
+	if !bytes.HasPrefix(header, []byte(segmentMagic)) {
+		return nil, errors.New("not a segment")
+	}
+	d := &decoder{b: header[len(segmentMagic):]}
+	rows := d.uvarint()
+	if rows > math.MaxInt32 {
+		return nil, fmt.Errorf("invalid segment header: %d rows", rows)
+	}
+	seg := &SegmentReader{
+		r:       r,
+		rows:    int(rows),
+		columns: map[string]columnRef{},
+		data:    int64(read) + int64(headerLen),
+	}
+	cols := d.uvarint()
+	for i := uint64(0); i < cols && d.err == nil; i++ {
+		p := d.string()
+		offset, length := d.uvarint(), d.uvarint()
+		if offset > math.MaxInt64-length {
+			return nil, fmt.Errorf("invalid segment header: column %q out of range", p)
+		}
+		seg.paths = append(seg.paths, p)
+		seg.columns[p] = columnRef{offset: int64(offset), length: int64(length)}
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("invalid segment header: %w", d.err)
+	}
+	return seg, nil
+}
+
+// Rows returns the number of records in the segment.
+func (seg *SegmentReader) Rows() int {
+	return seg.rows
+}
+
+// Columns returns the paths stored in the segment, sorted.
+func (seg *SegmentReader) Columns() []string {
+	return seg.paths
+}
+
+// ScanColumn calls fn for every record that has a value at path, in row
+// order, until fn returns false. Values are compacted, like in the records
+// the segment was written from.
+func (seg *SegmentReader) ScanColumn(path string, fn func(row int, v any) bool) error {
+	ref, ok := seg.columns[path]
+	if !ok {
+		return fmt.Errorf("column %q: %w", path, ErrNotFound)
+	}
+	block, err := readBlock(seg.r, seg.data+ref.offset, uint64(ref.length))
+	if err != nil {
+		return fmt.Errorf("could not read column %q: %w", path, err)
+	}
+
+	d := &decoder{b: block}
+	n := d.uvarint()
+	if n > uint64(len(block)) {
+		return fmt.Errorf("invalid column %q: %d values in %d bytes", path, n, len(block))
+	}
+	table := make([]any, n)
+	for i := range table {
+		if err := json.Unmarshal([]byte(d.string()), &table[i]); err != nil && d.err == nil {
+			d.err = err
+		}
+	}
+	runs := d.uvarint()
+	codeWidth, lengthWidth := int(d.byte()), int(d.byte())
+	if d.err != nil {
+		return fmt.Errorf("invalid column %q: %w", path, d.err)
+	}
+	// every run covers a row and differs from the previous one, so only
+	// codes of at least one bit allow more than one run
+	switch {
+	case codeWidth > 64 || lengthWidth > 64:
+		return fmt.Errorf("invalid column %q: %d and %d bit values", path, codeWidth, lengthWidth)
+	case runs > uint64(seg.rows), codeWidth == 0 && runs > 1, runs > uint64(len(d.b))*8/uint64(max(codeWidth, 1)):
+		return fmt.Errorf("invalid column %q: %d runs", path, runs)
+	}
+	codes, err := unpack(d.b, int(runs), codeWidth)
+	if err != nil {
+		return err
+	}
+	lengths, err := unpack(d.b[(int(runs)*codeWidth+7)/8:], int(runs), lengthWidth)
+	if err != nil {
+		return err
+	}
+
+	row := 0
+	for i, code := range codes {
+		if lengths[i] >= uint64(seg.rows-row) {
+			return fmt.Errorf("invalid column %q: runs exceed %d rows", path, seg.rows)
+		}
+		n := int(lengths[i]) + 1
+		if code == 0 {
+			row += n
+			continue
+		}
+		if int(code) > len(table) {
+			return fmt.Errorf("invalid column %q: unknown code %d", path, code)
+		}
+		for j := 0; j < n; j++ {
+			if !fn(row, table[code-1]) {
+				return nil
+			}
+			row++
+		}
+	}
+	return nil
+}
+
+// readBlock reads n bytes at off. The buffer grows with the data actually
+// read, so a corrupt length cannot make it allocate more than the input.
+func readBlock(r io.ReaderAt, off int64, n uint64) ([]byte, error) {
+	if n > math.MaxInt64-uint64(off) {
+		return nil, errors.New("block out of range")
+	}
+	b, err := io.ReadAll(io.NewSectionReader(r, off, int64(n)))
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(b)) != n {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return b, nil
+}
+
+// decoder reads the primitives of a segment, remembering the first error.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		d.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.b) == 0 {
+		d.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	v := d.b[0]
+	d.b = d.b[1:]
+	return v
+}
+
+func (d *decoder) string() string {
+	n := d.uvarint()
+	if d.err != nil {
+		return ""
+	}
+	if uint64(len(d.b)) < n {
+		d.err = io.ErrUnexpectedEOF
+		return ""
+	}
+	v := string(d.b[:n])
+	d.b = d.b[n:]
+	return v
+}
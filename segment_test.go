@@ -0,0 +1,145 @@
+package fstore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+)
+
+func TestSegment(t *testing.T) {
+	f := Listener()
+	f.Threshhold = 5
+	f.UseKeyCompression = true
+
+	var records []any
+	var ndjson bytes.Buffer
+	for i := 0; i < 30; i++ {
+		var data map[string]any
+		if err := json.Unmarshal(fp2, &data); err != nil {
+			t.Fatal(err)
+		}
+		data["hardwareConcurrency"] = float64(4 + 4*(i/10))
+		if i == 3 {
+			delete(data, "hardwareConcurrency")
+		}
+		id, err := f.Put(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec, _ := f.Compacted(id)
+		records = append(records, rec)
+		b, _ := json.Marshal(rec)
+		ndjson.Write(append(b, '\n'))
+	}
+	// deltas are resolved
+	first, err := f.Get(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := f.StoreDelta(0, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records = append(records, d)
+
+	var seg bytes.Buffer
+	if err := f.WriteSegment(&seg, records); err != nil {
+		t.Fatal(err)
+	}
+	if seg.Len() >= ndjson.Len()/5 {
+		t.Errorf("expected the segment to be much smaller than the records: %d vs %d bytes", seg.Len(), ndjson.Len())
+	}
+
+	r, err := OpenSegment(bytes.NewReader(seg.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Rows() != 31 {
+		t.Errorf("expected 31 rows, got %d", r.Rows())
+	}
+
+	counts := map[float64]int{}
+	rows := 0
+	err = r.ScanColumn("hardwareConcurrency", func(row int, v any) bool {
+		counts[v.(float64)]++
+		rows++
+		if row == 3 {
+			t.Error("row 3 has no value")
+		}
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows != 30 || counts[4] != 10 || counts[8] != 10 || counts[12] != 10 {
+		t.Errorf("unexpected column values: %v", counts)
+	}
+
+	var ua any
+	if err := r.ScanColumn("userAgent", func(row int, v any) bool {
+		ua = v
+		return false
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := f.Restore(ua); got != "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/117.0.0.0 Safari/537.36" {
+		t.Errorf("unexpected user agent %v", got)
+	}
+}
+
+func TestSegmentCorrupt(t *testing.T) {
+	segment := func(length uint64, block []byte) []byte {
+		header := []byte(segmentMagic)
+		header = binary.AppendUvarint(header, 2) // rows
+		header = binary.AppendUvarint(header, 1) // columns
+		header = appendString(header, "a")
+		header = binary.AppendUvarint(header, 0)
+		header = binary.AppendUvarint(header, length)
+		b := binary.AppendUvarint(nil, uint64(len(header)))
+		return append(append(b, header...), block...)
+	}
+	column := func(runs uint64, codeWidth, lengthWidth byte, packed ...byte) []byte {
+		b := binary.AppendUvarint(nil, 1)
+		b = appendString(b, `"x"`)
+		b = binary.AppendUvarint(b, runs)
+		return append(append(b, codeWidth, lengthWidth), packed...)
+	}
+
+	if _, err := OpenSegment(bytes.NewReader(binary.AppendUvarint(nil, 1<<60))); err == nil {
+		t.Error("expected an error for a header longer than the input")
+	}
+
+	valid := column(1, 1, 1, 0b01, 0b1)
+	whole := func(block []byte) []byte {
+		return segment(uint64(len(block)), block)
+	}
+	tests := map[string][]byte{
+		"valid":            whole(valid),
+		"long block":       segment(1<<60, valid),
+		"many empty runs":  whole(column(1<<40, 0, 0)),
+		"many runs":        whole(column(1<<20, 1, 0, 0xff)),
+		"runs exceed rows": whole(column(1, 1, 8, 0b01, 200)),
+		"wide values":      whole(column(1, 65, 0, 0xff)),
+	}
+	for name, seg := range tests {
+		r, err := OpenSegment(bytes.NewReader(seg))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		rows := 0
+		err = r.ScanColumn("a", func(row int, v any) bool {
+			rows++
+			return true
+		})
+		if name == "valid" {
+			if err != nil || rows != 2 {
+				t.Errorf("valid segment: %d rows, %v", rows, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
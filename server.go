@@ -0,0 +1,247 @@
+package fstore
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Content types understood by the Handler. Gob bodies hold a single value
+// encoded as an interface, i.e. Encode(&v) with v of type any.
+const (
+	ContentTypeJSON = "application/json"
+	ContentTypeGob  = "application/x-gob"
+)
+
+func init() {
+	// types found in decoded and restored data
+	gob.Register(map[string]any{})
+	gob.Register([]any{})
+	gob.Register(&Object{})
+	// responses
+	gob.Register(RecordResponse{})
+	gob.Register(StatsResponse{})
+	gob.Register(Entry{})
+	gob.Register(syncResponse{})
+}
+
+// Handler serves a StoreListener over HTTP:
+//
+//	POST /records       store the body, respond with its id
+//	GET  /records/{id}  the restored record
+//	GET  /dict/{id}     a dictionary entry, ?kind=key or ?kind=shape for
+//	                    other entries than values
+//	GET  /dict          the entries added since the version given by
+//	                    ?values=n&keys=n&shapes=n, see Replica
+//	GET  /stats         the listener's Stats and the number of entries
+//
+// Bodies are JSON or gob, picked by the Content-Type and Accept headers.
+// Calls to the listener are serialized.
+type Handler struct {
+	// MaxBodyBytes limits request bodies, larger ones are rejected with
+	// 413 Request Entity Too Large. Zero means DefaultMaxBodyBytes.
+	MaxBodyBytes int64
+
+	mu  sync.Mutex
+	s   *StoreListener
+	mux *http.ServeMux
+}
+
+// DefaultMaxBodyBytes is the request body limit of a Handler without
+// MaxBodyBytes.
+const DefaultMaxBodyBytes = 10 << 20
+
+// RecordResponse is the response of POST /records.
+type RecordResponse struct {
+	ID RecordID `json:"id"`
+}
+
+// StatsResponse is the response of GET /stats.
+type StatsResponse struct {
+	Stats   Stats `json:"stats"`
+	Records int   `json:"records"`
+	Values  int   `json:"values"`
+	Keys    int   `json:"keys"`
+	Shapes  int   `json:"shapes"`
+}
+
+func NewHandler(s *StoreListener) *Handler {
+	h := &Handler{s: s, mux: http.NewServeMux()}
+	h.mux.HandleFunc("POST /records", h.postRecord)
+	h.mux.HandleFunc("GET /records/{id}", h.getRecord)
+	h.mux.HandleFunc("GET /dict/{id}", h.getEntry)
+	h.mux.HandleFunc("GET /dict", h.getEntries)
+	h.mux.HandleFunc("GET /stats", h.getStats)
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) postRecord(w http.ResponseWriter, r *http.Request) {
+	limit := h.MaxBodyBytes
+	if limit <= 0 {
+		limit = DefaultMaxBodyBytes
+	}
+	data, err := decodeBody(http.MaxBytesReader(w, r.Body, limit), r.Header.Get("Content-Type"))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.mu.Lock()
+	id, err := h.s.Put(data)
+	h.mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/records/%d", id))
+	writeBody(w, r, http.StatusCreated, RecordResponse{ID: id})
+}
+
+func (h *Handler) getRecord(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid record id", http.StatusBadRequest)
+		return
+	}
+
+	h.mu.Lock()
+	data, err := h.s.Get(RecordID(id))
+	h.mu.Unlock()
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeBody(w, r, http.StatusOK, data)
+}
+
+func (h *Handler) getEntry(w http.ResponseWriter, r *http.Request) {
+	kind := ValueEntry
+	switch r.URL.Query().Get("kind") {
+	case "", "value":
+	case "key":
+		kind = KeyEntry
+	case "shape":
+		kind = ShapeEntry
+	default:
+		http.Error(w, "invalid kind", http.StatusBadRequest)
+		return
+	}
+
+	h.mu.Lock()
+	e, ok := h.s.database.Entry(kind, r.PathValue("id"))
+	h.mu.Unlock()
+	if !ok {
+		http.Error(w, "entry not found", http.StatusNotFound)
+		return
+	}
+	writeBody(w, r, http.StatusOK, e)
+}
+
+func (h *Handler) getEntries(w http.ResponseWriter, r *http.Request) {
+	var since Version
+	for name, n := range map[string]*int{"values": &since.Values, "keys": &since.Keys, "shapes": &since.Shapes} {
+		if q := r.URL.Query().Get(name); q != "" {
+			var err error
+			if *n, err = strconv.Atoi(q); err != nil {
+				http.Error(w, "invalid version", http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	h.mu.Lock()
+	resp := syncResponse{Version: h.s.database.Version(), Entries: h.s.database.Since(since)}
+	h.mu.Unlock()
+	writeBody(w, r, http.StatusOK, resp)
+}
+
+func (h *Handler) getStats(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	resp := StatsResponse{
+		Stats:   h.s.Stats(),
+		Records: len(h.s.records.records),
+		Values:  len(h.s.database.hashValues),
+		Keys:    len(h.s.database.hashKeys),
+		Shapes:  len(h.s.database.shapes),
+	}
+	h.mu.Unlock()
+	writeBody(w, r, http.StatusOK, resp)
+}
+
+// decodeBody decodes a request body by its Content-Type, JSON if there is
+// none. JSON objects keep their key order, see DecodeJSON.
+func decodeBody(body io.Reader, ct string) (any, error) {
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	if ct != "" {
+		if ct, _, err = mime.ParseMediaType(ct); err != nil {
+			return nil, err
+		}
+	}
+
+	switch ct {
+	case "", ContentTypeJSON:
+		return DecodeJSON(b)
+	case ContentTypeGob:
+		var data any
+		if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&data); err != nil {
+			return nil, fmt.Errorf("could not decode gob: %w", err)
+		}
+		return data, nil
+	}
+	return nil, fmt.Errorf("unsupported content type %q", ct)
+}
+
+// writeBody writes v as gob if the request accepts it, as JSON otherwise.
+// Gob values are encoded as an interface, like request bodies.
+func writeBody(w http.ResponseWriter, r *http.Request, status int, v any) {
+	var buf bytes.Buffer
+	ct := ContentTypeJSON
+	if accepts(r, ContentTypeGob) {
+		ct = ContentTypeGob
+		if err := gob.NewEncoder(&buf).Encode(&v); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	} else if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ct)
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// accepts reports whether the Accept header of r lists the media type.
+func accepts(r *http.Request, mediaType string) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mt, _, err := mime.ParseMediaType(strings.TrimSpace(part)); err == nil && mt == mediaType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package fstore
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	f := Listener()
+	f.Threshhold = 5
+	f.CollectStats = true
+	srv := httptest.NewServer(NewHandler(f))
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/records", ContentTypeJSON, strings.NewReader(`{"user_agent":"Mozilla/5.0 A","cores":8}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var created RecordResponse
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || resp.Header.Get("Location") != "/records/0" {
+		t.Fatalf("unexpected response %s, location %q", resp.Status, resp.Header.Get("Location"))
+	}
+
+	// gob in, gob out
+	var body bytes.Buffer
+	var data any = map[string]any{"user_agent": "Mozilla/5.0 B", "fonts": []any{"Arial", "Helvetica"}}
+	if err := gob.NewEncoder(&body).Encode(&data); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = http.Post(srv.URL+"/records", ContentTypeGob, &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	req, _ := http.NewRequest("GET", srv.URL+"/records/1", nil)
+	req.Header.Set("Accept", ContentTypeGob)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got any
+	if err := gob.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("Content-Type") != ContentTypeGob || !reflect.DeepEqual(got, data) {
+		t.Errorf("got %#v as %s", got, resp.Header.Get("Content-Type"))
+	}
+
+	tests := []struct {
+		path   string
+		status int
+		want   string
+	}{
+		{"/records/0", http.StatusOK, `{"user_agent":"Mozilla/5.0 A","cores":8}`},
+		{"/records/5", http.StatusNotFound, ""},
+		{"/records/x", http.StatusBadRequest, ""},
+		{"/dict/h_3", http.StatusOK, `{"kind":"value","id":"h_3","value":"Mozilla/5.0 B","refs":1`},
+		{"/dict/h_9", http.StatusNotFound, ""},
+		{"/stats", http.StatusOK, `"records":2,"values":4`},
+	}
+	for _, tt := range tests {
+		resp, err := http.Get(srv.URL + tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b bytes.Buffer
+		b.ReadFrom(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.status || !strings.Contains(b.String(), tt.want) {
+			t.Errorf("%s: got %s %s", tt.path, resp.Status, b.String())
+		}
+	}
+
+	resp, err = http.Post(srv.URL+"/records", "text/plain", strings.NewReader("x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected unsupported content types to be rejected, got %s", resp.Status)
+	}
+}
+
+func TestHandlerBodyLimit(t *testing.T) {
+	h := NewHandler(Listener())
+	h.MaxBodyBytes = 64
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	big := `{"user_agent":"` + strings.Repeat("x", 100) + `"}`
+	resp, err := http.Post(srv.URL+"/records", ContentTypeJSON, strings.NewReader(big))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected large bodies to be rejected, got %s", resp.Status)
+	}
+	resp, err = http.Post(srv.URL+"/records", ContentTypeJSON, strings.NewReader(`{"cores":8}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("expected small bodies to be accepted, got %s", resp.Status)
+	}
+}
+
+func TestEntryJSON(t *testing.T) {
+	e := Entry{Kind: ShapeEntry, ID: "s_0", Keys: []string{"a", "b"}, Refs: 2}
+	b, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(b), `{"kind":"shape","id":"s_0","keys":["a","b"],"refs":2,`) {
+		t.Errorf("unexpected encoding %s", b)
+	}
+	var got Entry
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, e) {
+		t.Errorf("got %+v, want %+v", got, e)
+	}
+	if err := json.Unmarshal([]byte(`{"kind":"blob"}`), &got); err == nil {
+		t.Error("expected unknown kinds to be rejected")
+	}
+}
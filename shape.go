@@ -0,0 +1,155 @@
+package fstore
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Shaped is an object stored as a reference to its shape, the ordered list
+// of its keys kept once in the dictionary, plus its values in that order.
+// Store produces it for every object when UseShapes is set.
+type Shaped struct {
+	Shape  string
+	Values []any
+}
+
+// shapedJSON is the JSON form of a Shaped.
+type shapedJSON struct {
+	Shape  string `json:"$s"`
+	Values []any  `json:"$v"`
+}
+
+func (sh *Shaped) MarshalJSON() ([]byte, error) {
+	return json.Marshal(shapedJSON{Shape: sh.Shape, Values: sh.Values})
+}
+
+func (sh *Shaped) UnmarshalJSON(b []byte) error {
+	var v shapedJSON
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	sh.Shape, sh.Values = v.Shape, v.Values
+	return nil
+}
+
+// asShaped recognizes a Shaped in data decoded from JSON.
+func asShaped(data any) (*Shaped, bool) {
+	var m map[string]any
+	switch v := data.(type) {
+	case *Shaped:
+		return v, true
+	case *Object:
+		m = v.Values
+	case map[string]any:
+		m = v
+	default:
+		return nil, false
+	}
+
+	if len(m) != 2 {
+		return nil, false
+	}
+	shape, ok := m["$s"].(string)
+	if !ok {
+		return nil, false
+	}
+	values, ok := m["$v"].([]any)
+	if !ok {
+		return nil, false
+	}
+	return &Shaped{Shape: shape, Values: values}, true
+}
+
+func shapeKey(keys []string) string {
+	b, _ := json.Marshal(keys)
+	return string(b)
+}
+
+// SaveShape returns the id of the shape made of keys, adding it if needed.
+func (d *Database) SaveShape(keys []string) string {
+	k := shapeKey(keys)
+	if id, ok := d.shapeIDs[k]; ok {
+		d.reuse(ShapeEntry, id)
+		return id
+	}
+
+	id := fmt.Sprintf("s_%v", len(d.shapes))
+	d.add(ShapeEntry, id, "", append([]string(nil), keys...))
+	d.counters.newEntries++
+	d.counters.bytesAdded += len(id) + len(k)
+	d.use(ShapeEntry, id)
+	return id
+}
+
+func (s *StoreListener) restoreShaped(sh *Shaped) (any, error) {
+	keys, ok := s.database.shapes[sh.Shape]
+	if !ok {
+		return nil, fmt.Errorf("unknown shape %q: %w", sh.Shape, ErrMissingEntries)
+	}
+	if len(keys) != len(sh.Values) {
+		return nil, fmt.Errorf("shape %q has %d keys, got %d values", sh.Shape, len(keys), len(sh.Values))
+	}
+
+	result := NewObject()
+	for i, k := range keys {
+		r, err := s.Restore(sh.Values[i])
+		if err != nil {
+			return nil, err
+		}
+		result.Set(k, r)
+	}
+	return result, nil
+}
+
+// FieldSet collects the compacted fields of an object. Depending on the
+// listener settings it becomes a map, an *Object or a *Shaped.
+type FieldSet struct {
+	s       *StoreListener
+	ordered bool // becomes an *Object
+	keys    []string
+	values  []any
+}
+
+// NewFieldSet returns an empty FieldSet. Generated compactors use it to
+// build objects.
+func (s *StoreListener) NewFieldSet() *FieldSet {
+	return &FieldSet{s: s}
+}
+
+// Set adds a compacted value under name, unless it is empty.
+func (f *FieldSet) Set(name string, v any) {
+	if isEmpty(v) {
+		return
+	}
+	if !f.s.UseShapes {
+		name = f.s.saveKey(name)
+	}
+	f.add(name, v)
+}
+
+// add adds a value under a key that already went through the dictionary.
+func (f *FieldSet) add(key string, v any) {
+	f.keys = append(f.keys, key)
+	f.values = append(f.values, v)
+}
+
+// Value returns the compacted object.
+func (f *FieldSet) Value() any {
+	// empty objects are dropped by the parent, or stored as {} at the top
+	// level, so they never need a shape
+	if f.s.UseShapes && len(f.keys) > 0 {
+		return &Shaped{Shape: f.s.database.SaveShape(f.keys), Values: f.values}
+	}
+	if f.ordered {
+		return &Object{Keys: f.keys, Values: f.fields()}
+	}
+	return f.fields()
+}
+
+func (f *FieldSet) fields() map[string]any {
+	m := make(map[string]any, len(f.keys))
+	for i, k := range f.keys {
+		m[k] = f.values[i]
+	}
+	return m
+}
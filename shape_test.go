@@ -0,0 +1,141 @@
+package fstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestShapes(t *testing.T) {
+	f := Listener()
+	f.Threshhold = 5
+	f.UseShapes = true
+
+	var records, dict bytes.Buffer
+	in := bytes.Repeat(append(bytes.TrimSpace(compactJSON(t, fp2)), '\n'), 3)
+	report, err := f.StoreBatch(bytes.NewReader(in), &records, &dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Stored != 3 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	keyed := Listener()
+	keyed.Threshhold = 5
+	keyed.UseKeyCompression = true
+	res, err := keyed.StoreJSON(fp2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withKeys, err := json.Marshal(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.Split(bytes.TrimSpace(records.Bytes()), []byte("\n"))
+	if len(lines[2]) >= len(withKeys) {
+		t.Errorf("expected shaped records to be smaller than key compressed ones: %d >= %d", len(lines[2]), len(withKeys))
+	}
+
+	db, err := ReadDatabase(&dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restorer := Listener()
+	restorer.SetDatabase(db)
+	stored, err := DecodeJSON(lines[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err := restorer.Restore(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := keyed.Restore(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := json.Marshal(restored)
+	wantJSON, _ := json.Marshal(want)
+	if !bytes.Equal(got, wantJSON) {
+		t.Errorf("restored shaped record differs:\n%s\n%s", got, wantJSON)
+	}
+}
+
+func compactJSON(t *testing.T, b []byte) []byte {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, b); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestMarkerKeys(t *testing.T) {
+	inputs := []string{
+		`{"$s":"s_0","$v":["abcdef"]}`,
+		`{"$base":0,"$patch":{"a":"abcdef"}}`,
+		`{"$version":"1.0.0","$record":"abcdef"}`,
+		`{"$$x":"abcdef","$":1,"a":{"$s":"s_0","$v":["x"]}}`,
+	}
+	for _, in := range inputs {
+		f := Listener()
+		f.Threshhold = 5
+		if _, err := f.Put(map[string]any{"a": "abcdef"}); err != nil {
+			t.Fatal(err)
+		}
+		data, err := DecodeJSON([]byte(in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := f.Store(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := json.Marshal(res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored, err := DecodeJSON(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := f.Restore(stored)
+		if err != nil {
+			t.Fatalf("%s: %v", in, err)
+		}
+		if got, _ := json.Marshal(out); string(got) != in {
+			t.Errorf("restored %s, want %s", got, in)
+		}
+	}
+}
+
+func TestEmptyShapes(t *testing.T) {
+	type inner struct {
+		Name string `json:"name"`
+	}
+	type outer struct {
+		Inner inner  `json:"inner"`
+		Tags  []any  `json:"tags"`
+		Name  string `json:"name"`
+	}
+	f := Listener()
+	f.Threshhold = 5
+	f.UseShapes = true
+	if _, err := f.Store(outer{Name: "abc"}); err != nil {
+		t.Fatal(err)
+	}
+	if shapes := f.Database().Entries(ShapeEntry); len(shapes) != 1 {
+		t.Errorf("expected only the shape of the outer object, got %+v", shapes)
+	}
+	before := f.Database().Version()
+	res, err := f.Store(inner{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Database().Version() != before {
+		t.Error("storing an empty object changed the dictionary")
+	}
+	if out, err := f.Restore(res); err != nil || !isEmpty(out) {
+		t.Errorf("restored %v, %v, want an empty object", out, err)
+	}
+}
@@ -0,0 +1,239 @@
+package fstore
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"sort"
+)
+
+// MinHash signatures have minhashSize values, split into lshBands bands.
+// Records that agree on all values of a band are compared, so records
+// with a Jaccard similarity of 0.5 are found with a probability of 64%,
+// at 0.8 almost always.
+const (
+	minhashSize = 64
+	lshBands    = 16
+	lshRows     = minhashSize / lshBands
+)
+
+var minhashSeeds = func() [minhashSize]uint64 {
+	var seeds [minhashSize]uint64
+	for i := range seeds {
+		seeds[i] = splitmix64(uint64(i) + 1)
+	}
+	return seeds
+}()
+
+// splitmix64 mixes the bits of x, see
+// https://prng.di.unimi.it/splitmix64.c
+func splitmix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+type signature [minhashSize]uint64
+
+// Match is a record found by Similar, with its estimated Jaccard
+// similarity to the data.
+type Match struct {
+	ID         RecordID
+	Similarity float64
+}
+
+// lshIndex keeps the MinHash signature of every record and buckets them
+// by band.
+type lshIndex struct {
+	signatures map[RecordID]*signature
+	buckets    [lshBands]map[uint64][]RecordID
+}
+
+func newLSHIndex() *lshIndex {
+	idx := &lshIndex{signatures: map[RecordID]*signature{}}
+	for i := range idx.buckets {
+		idx.buckets[i] = map[uint64][]RecordID{}
+	}
+	return idx
+}
+
+// minhash computes the signature of compacted data, over the set of its
+// (path, compacted value) pairs.
+func (s *StoreListener) minhash(data any) *signature {
+	sig := &signature{}
+	for i := range sig {
+		sig[i] = ^uint64(0)
+	}
+	s.walkLeaves(data, "", func(path string, v any) {
+		h := fnv.New64a()
+		h.Write([]byte(path))
+		h.Write([]byte{0})
+		h.Write([]byte(indexKey(v)))
+		x := h.Sum64()
+		for i, seed := range minhashSeeds {
+			if m := splitmix64(x ^ seed); m < sig[i] {
+				sig[i] = m
+			}
+		}
+	})
+	return sig
+}
+
+// band hashes the rows of band b of a signature.
+func (sig *signature) band(b int) uint64 {
+	h := fnv.New64a()
+	var buf [8]byte
+	for _, v := range sig[b*lshRows : (b+1)*lshRows] {
+		binary.LittleEndian.PutUint64(buf[:], v)
+		h.Write(buf[:])
+	}
+	return h.Sum64()
+}
+
+// similarity estimates the Jaccard similarity of the sets behind two
+// signatures.
+func (sig *signature) similarity(o *signature) float64 {
+	same := 0
+	for i := range sig {
+		if sig[i] == o[i] {
+			same++
+		}
+	}
+	return float64(same) / minhashSize
+}
+
+func (idx *lshIndex) add(id RecordID, sig *signature) {
+	idx.signatures[id] = sig
+	for b := range idx.buckets {
+		key := sig.band(b)
+		idx.buckets[b][key] = append(idx.buckets[b][key], id)
+	}
+}
+
+func (idx *lshIndex) remove(id RecordID) {
+	sig, ok := idx.signatures[id]
+	if !ok {
+		return
+	}
+	delete(idx.signatures, id)
+	for b := range idx.buckets {
+		key := sig.band(b)
+		ids := idx.buckets[b][key]
+		for i, other := range ids {
+			if other == id {
+				ids = append(ids[:i], ids[i+1:]...)
+				break
+			}
+		}
+		if len(ids) == 0 {
+			delete(idx.buckets[b], key)
+		} else {
+			idx.buckets[b][key] = ids
+		}
+	}
+}
+
+// Similar returns up to k stored records most similar to data, most
+// similar first. Records are compared by the MinHash of their (path,
+// dictionary id) pairs, and only records sharing a band of it with data
+// are considered, so very dissimilar records are never returned. The
+// index is built on the first call and kept up to date afterwards. The
+// dictionary is not changed.
+func (s *StoreListener) Similar(data any, k int) ([]Match, error) {
+	if k < 0 {
+		return nil, fmt.Errorf("invalid number of matches %d", k)
+	}
+	res, err := s.probe(data)
+	if err != nil {
+		return nil, err
+	}
+	if s.lsh == nil {
+		s.lsh = newLSHIndex()
+		for _, id := range s.RecordIDs() {
+			rec, err := s.compactedFull(s.records.records[id])
+			if err != nil {
+				s.lsh = nil
+				return nil, err
+			}
+			s.lsh.add(id, s.minhash(rec))
+		}
+	}
+
+	sig := s.minhash(res)
+	seen := map[RecordID]bool{}
+	var matches []Match
+	for b := range s.lsh.buckets {
+		for _, id := range s.lsh.buckets[b][sig.band(b)] {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			matches = append(matches, Match{ID: id, Similarity: sig.similarity(s.lsh.signatures[id])})
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Similarity != matches[j].Similarity {
+			return matches[i].Similarity > matches[j].Similarity
+		}
+		return matches[i].ID < matches[j].ID
+	})
+	if len(matches) > k {
+		matches = matches[:k]
+	}
+	return matches, nil
+}
+
+// unknownValue is a probe value the dictionary does not have. No record
+// holds one, so it matches nothing.
+type unknownValue string
+
+// probe compacts data like Store, but against a private dictionary, and
+// maps the result onto the ids of the listener's dictionary without
+// changing it.
+func (s *StoreListener) probe(data any) (any, error) {
+	w := s.worker()
+	res, err := w.store(data)
+	if err != nil {
+		return nil, err
+	}
+	return s.lookup(w, res)
+}
+
+// lookup maps res, compacted by the worker w, onto the ids of the
+// listener's dictionary, see probe.
+func (s *StoreListener) lookup(w *StoreListener, res any) (any, error) {
+	named, err := w.named(res)
+	if err != nil {
+		return nil, err
+	}
+	return resolved{s.lookupValues(named, &w.database)}, nil
+}
+
+// lookupValues replaces the value ids of local in data by the ids of the
+// same values in the listener's dictionary.
+func (s *StoreListener) lookupValues(data any, local *Database) any {
+	if keys, fields, ok := objectFields(data); ok {
+		obj := NewObject()
+		for _, k := range keys {
+			obj.Set(k, s.lookupValues(fields[k], local))
+		}
+		return obj
+	}
+	if arr, ok := data.([]any); ok {
+		res := make([]any, len(arr))
+		for i, e := range arr {
+			res[i] = s.lookupValues(e, local)
+		}
+		return res
+	}
+	if str, ok := data.(string); ok && IsRef(str) {
+		val := local.hashValues[str]
+		if id, ok := s.database.valueIDs[val]; ok {
+			return id
+		}
+		return unknownValue(val)
+	}
+	return data
+}
@@ -0,0 +1,83 @@
+package fstore
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestSimilar(t *testing.T) {
+	f := Listener()
+	f.Threshhold = 5
+
+	other := map[string]any{}
+	for i := 0; i < 60; i++ {
+		other[fmt.Sprintf("key_%d", i)] = fmt.Sprintf("other-%d", i)
+	}
+	for i := 0; i < 10; i++ {
+		if _, err := f.Put(other); err != nil {
+			t.Fatal(err)
+		}
+	}
+	near, err := f.Put(clusterRecord(t, 1, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matches, err := f.Similar(clusterRecord(t, 2, nil), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 || matches[0].ID != near || matches[0].Similarity < 0.8 {
+		t.Fatalf("unexpected matches %v", matches)
+	}
+
+	// the index is kept up to date after the first call
+	nearer, err := f.Put(clusterRecord(t, 2, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	matches, _ = f.Similar(clusterRecord(t, 2, nil), 5)
+	if len(matches) != 2 || matches[0].Similarity != 1 || (matches[1].ID != nearer && matches[0].ID != nearer) {
+		t.Fatalf("unexpected matches after put %v", matches)
+	}
+	if err := f.Delete(nearer); err != nil {
+		t.Fatal(err)
+	}
+	matches, _ = f.Similar(clusterRecord(t, 2, nil), 1)
+	if len(matches) != 1 || matches[0].ID != near {
+		t.Fatalf("unexpected matches after delete %v", matches)
+	}
+}
+
+func TestSimilarReadOnly(t *testing.T) {
+	for _, shapes := range []bool{false, true} {
+		f := Listener()
+		f.Threshhold = 5
+		f.UseKeyCompression = true
+		f.UseShapes = shapes
+		id, err := f.Put(clusterRecord(t, 1, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		version, before := f.Database().Version(), f.Database().Entries(ValueEntry)
+		matches, err := f.Similar(clusterRecord(t, 1, nil), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(matches) != 1 || matches[0].ID != id || matches[0].Similarity != 1 {
+			t.Errorf("shapes %v: unexpected matches %v", shapes, matches)
+		}
+		// values the dictionary does not know match nothing
+		if _, err := f.Similar(map[string]any{"userAgent": "not stored anywhere"}, 1); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Similar(clusterRecord(t, 1, nil), -1); err == nil {
+			t.Error("expected an error for a negative number of matches")
+		}
+		if f.Database().Version() != version || !reflect.DeepEqual(f.Database().Entries(ValueEntry), before) {
+			t.Errorf("shapes %v: Similar changed the dictionary", shapes)
+		}
+	}
+}
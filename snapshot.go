@@ -0,0 +1,155 @@
+package fstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// ErrMissingEntries is returned by Restore for records that reference
+// entries the dictionary does not have yet. Versioned records are checked
+// up front, others when an unknown id is found.
+var ErrMissingEntries = errors.New("dictionary is missing entries")
+
+// Snapshot is a read-only view of a Database at a version. Entries are
+// only ever appended, so a snapshot shares them with the dictionary and
+// stays valid, and safe to read, while the dictionary grows.
+type Snapshot struct {
+	values []string
+	keys   []string
+	shapes [][]string
+}
+
+// Snapshot returns a view of the dictionary as it is now.
+func (d *Database) Snapshot() *Snapshot {
+	return &Snapshot{
+		values: d.valueList[:len(d.valueList):len(d.valueList)],
+		keys:   d.keyList[:len(d.keyList):len(d.keyList)],
+		shapes: d.shapeList[:len(d.shapeList):len(d.shapeList)],
+	}
+}
+
+// Version returns the version of the dictionary the snapshot was taken at.
+func (s *Snapshot) Version() Version {
+	return Version{Values: len(s.values), Keys: len(s.keys), Shapes: len(s.shapes)}
+}
+
+// Len returns the number of entries of all kinds.
+func (s *Snapshot) Len() int {
+	return len(s.values) + len(s.keys) + len(s.shapes)
+}
+
+// Lookup returns the value behind a value id.
+func (s *Snapshot) Lookup(id string) (string, bool) {
+	return lookupSeq(s.values, id, "h_")
+}
+
+// LookupKey returns the key behind a key id.
+func (s *Snapshot) LookupKey(id string) (string, bool) {
+	return lookupSeq(s.keys, id, "h_")
+}
+
+// LookupShape returns a copy of the keys of a shape.
+func (s *Snapshot) LookupShape(id string) ([]string, bool) {
+	keys, ok := lookupSeq(s.shapes, id, "s_")
+	return slices.Clone(keys), ok
+}
+
+func lookupSeq[T any](list []T, id, prefix string) (T, bool) {
+	var zero T
+	n, ok := strings.CutPrefix(id, prefix)
+	if !ok {
+		return zero, false
+	}
+	i, err := strconv.Atoi(n)
+	if err != nil || i < 0 || i >= len(list) {
+		return zero, false
+	}
+	return list[i], true
+}
+
+// MarshalText encodes a version like "12.3.1", values, keys and shapes.
+func (v Version) MarshalText() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+func (v *Version) UnmarshalText(b []byte) error {
+	parts := strings.Split(string(b), ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("invalid version %q", b)
+	}
+	var n [3]int
+	for i, p := range parts {
+		var err error
+		if n[i], err = strconv.Atoi(p); err != nil || n[i] < 0 {
+			return fmt.Errorf("invalid version %q", b)
+		}
+	}
+	*v = Version{Values: n[0], Keys: n[1], Shapes: n[2]}
+	return nil
+}
+
+// Versioned is a compacted record with a header carrying the version of
+// the dictionary it was compacted against. Restore refuses it with
+// ErrMissingEntries if the dictionary is older.
+type Versioned struct {
+	Version Version
+	Record  any
+}
+
+// versionedJSON is the JSON form of a Versioned.
+type versionedJSON struct {
+	Version Version `json:"$version"`
+	Record  any     `json:"$record"`
+}
+
+func (v *Versioned) MarshalJSON() ([]byte, error) {
+	return json.Marshal(versionedJSON{Version: v.Version, Record: v.Record})
+}
+
+// asVersioned recognizes a Versioned in data decoded from JSON.
+func asVersioned(data any) (*Versioned, bool) {
+	if v, ok := data.(*Versioned); ok {
+		return v, true
+	}
+	keys, fields, ok := objectFields(data)
+	if !ok || len(keys) != 2 {
+		return nil, false
+	}
+	str, ok := fields["$version"].(string)
+	if !ok {
+		return nil, false
+	}
+	rec, ok := fields["$record"]
+	if !ok {
+		return nil, false
+	}
+	var v Version
+	if err := v.UnmarshalText([]byte(str)); err != nil {
+		return nil, false
+	}
+	return &Versioned{Version: v, Record: rec}, true
+}
+
+// StoreVersioned works like Store, but adds a header with the version of
+// the dictionary after the call, which has every entry the record uses.
+func (s *StoreListener) StoreVersioned(data any) (*Versioned, error) {
+	res, err := s.Store(data)
+	if err != nil {
+		return nil, err
+	}
+	return &Versioned{Version: s.database.Version(), Record: res}, nil
+}
+
+// checkVersion returns ErrMissingEntries if the dictionary is older than
+// the version a record needs.
+func (s *StoreListener) checkVersion(need Version) error {
+	if have := s.database.Version(); !have.Covers(need) {
+		return fmt.Errorf("record needs dictionary version %v, have %v: %w", need, have, ErrMissingEntries)
+	}
+	return nil
+}
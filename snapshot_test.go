@@ -0,0 +1,111 @@
+package fstore
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	d := GetDatabase()
+	d.SaveHash("a")
+	d.SaveKey("k")
+	d.SaveShape([]string{"x", "y"})
+
+	snap := d.Snapshot()
+	d.SaveHash("b")
+	d.SaveShape([]string{"z"})
+
+	if want := (Version{Values: 1, Keys: 1, Shapes: 1}); snap.Version() != want {
+		t.Errorf("got version %v, want %v", snap.Version(), want)
+	}
+	if v, ok := snap.Lookup("h_0"); !ok || v != "a" {
+		t.Errorf("got %q, %v", v, ok)
+	}
+	if _, ok := snap.Lookup("h_1"); ok {
+		t.Error("snapshot sees an entry added after it was taken")
+	}
+	if keys, ok := snap.LookupShape("s_0"); !ok || !reflect.DeepEqual(keys, []string{"x", "y"}) {
+		t.Errorf("got shape %v, %v", keys, ok)
+	} else {
+		keys[0] = "changed"
+		if again, _ := snap.LookupShape("s_0"); again[0] != "x" {
+			t.Error("changing a looked up shape changed the snapshot")
+		}
+	}
+	if keys, _ := d.LookupShape("s_0"); len(keys) == 2 {
+		keys[0] = "changed"
+	}
+	if e, _ := d.Entry(ShapeEntry, "s_0"); len(e.Keys) == 2 {
+		e.Keys[1] = "changed"
+	}
+	if keys, _ := snap.LookupShape("s_0"); !reflect.DeepEqual(keys, []string{"x", "y"}) {
+		t.Errorf("changing the keys of a dictionary shape changed the snapshot: %v", keys)
+	}
+	if d.Snapshot().Len() != 5 || snap.Len() != 3 {
+		t.Errorf("unexpected lengths %d and %d", d.Snapshot().Len(), snap.Len())
+	}
+}
+
+func TestVersioned(t *testing.T) {
+	f := Listener()
+	f.Threshhold = 5
+	f.UseKeyCompression = true
+
+	first, err := f.StoreVersioned(map[string]any{"user_agent": "Mozilla/5.0 A"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := f.Database().Snapshot().Version()
+	second, err := f.StoreVersioned(map[string]any{"user_agent": "Mozilla/5.0 B"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !second.Version.Covers(first.Version) || first.Version.Covers(second.Version) {
+		t.Errorf("versions do not increase: %v, %v", first.Version, second.Version)
+	}
+
+	b, err := json.Marshal(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := DecodeJSON(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a dictionary that only has the entries of the first record
+	c := Listener()
+	c.UseKeyCompression = true
+	var entries []Entry
+	for _, e := range f.Database().Since(Version{}) {
+		if e.Kind == KeyEntry || e.ID == "h_0" {
+			entries = append(entries, e)
+		}
+	}
+	if err := c.database.Apply(entries); err != nil {
+		t.Fatal(err)
+	}
+	if c.Database().Version() != old {
+		t.Fatalf("got version %v, want %v", c.Database().Version(), old)
+	}
+	if _, err := c.Restore(first); err != nil {
+		t.Errorf("could not restore the first record: %v", err)
+	}
+	if _, err := c.Restore(data); !errors.Is(err, ErrMissingEntries) {
+		t.Errorf("expected ErrMissingEntries, got %v", err)
+	}
+	// without the version, unknown ids are found while restoring
+	if _, err := c.Restore(second.Record); !errors.Is(err, ErrMissingEntries) {
+		t.Errorf("expected ErrMissingEntries for an unversioned record, got %v", err)
+	}
+
+	res, err := f.Restore(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := json.Marshal(res); string(got) != `{"user_agent":"Mozilla/5.0 B"}` {
+		t.Errorf("got %s", got)
+	}
+}
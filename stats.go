@@ -0,0 +1,76 @@
+package fstore
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Stats describes how much a Store call (or all of them, see
+// StoreListener.Stats) saved compared to storing the raw data.
+type Stats struct {
+	Calls           int // number of Store calls the stats cover
+	InputBytes      int // size of the input, encoded as JSON
+	OutputBytes     int // size of the compacted result, encoded as JSON
+	DictionaryBytes int // bytes added to the dictionary (ids and values)
+	References      int // number of dictionary references in the result
+	NewEntries      int // references that created a new dictionary entry
+	ReusedEntries   int // references that pointed to an existing entry
+}
+
+// Saved returns the number of bytes saved, counting the dictionary growth
+// against the compacted output.
+func (st Stats) Saved() int {
+	return st.InputBytes - st.OutputBytes - st.DictionaryBytes
+}
+
+// Ratio returns the stored size (output and dictionary growth) relative to
+// the input size. Values below 1 mean fStore saved space.
+func (st Stats) Ratio() float64 {
+	if st.InputBytes == 0 {
+		return 0
+	}
+	return float64(st.OutputBytes+st.DictionaryBytes) / float64(st.InputBytes)
+}
+
+func (st Stats) String() string {
+	return fmt.Sprintf(
+		"calls=%d in=%dB out=%dB dict=+%dB saved=%dB ratio=%.3f refs=%d (new=%d reused=%d)",
+		st.Calls, st.InputBytes, st.OutputBytes, st.DictionaryBytes,
+		st.Saved(), st.Ratio(), st.References, st.NewEntries, st.ReusedEntries,
+	)
+}
+
+func (st *Stats) add(o Stats) {
+	st.Calls += o.Calls
+	st.InputBytes += o.InputBytes
+	st.OutputBytes += o.OutputBytes
+	st.DictionaryBytes += o.DictionaryBytes
+	st.References += o.References
+	st.NewEntries += o.NewEntries
+	st.ReusedEntries += o.ReusedEntries
+}
+
+// measure builds the stats for a single Store call from the dictionary
+// counters before and after the call.
+func measure(data, result any, before, after dictCounters) (Stats, error) {
+	in, err := json.Marshal(data)
+	if err != nil {
+		return Stats{}, fmt.Errorf("could not measure input: %w", err)
+	}
+	out, err := json.Marshal(result)
+	if err != nil {
+		return Stats{}, fmt.Errorf("could not measure output: %w", err)
+	}
+
+	newEntries := after.newEntries - before.newEntries
+	reused := after.reusedEntries - before.reusedEntries
+	return Stats{
+		Calls:           1,
+		InputBytes:      len(in),
+		OutputBytes:     len(out),
+		DictionaryBytes: after.bytesAdded - before.bytesAdded,
+		References:      newEntries + reused,
+		NewEntries:      newEntries,
+		ReusedEntries:   reused,
+	}, nil
+}
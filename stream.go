@@ -0,0 +1,224 @@
+package fstore
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"golang.org/x/exp/slices"
+)
+
+// CompactJSON reads JSON documents from r and writes their compacted form
+// to w, one document per line. Unlike Store it does not decode the whole
+// document first: values are compacted token by token, so memory use only
+// depends on the nesting depth. Keys are written in input order.
+//
+// UseShapes is ignored: a shape is only known once the whole object has
+// been read. With UseKeyCompression, the key of a nested object gets its id
+// before the keys inside it, Store assigns them the other way round; both
+// restore to the same data.
+func (s *StoreListener) CompactJSON(r io.Reader, w io.Writer) error {
+	st := &streamer{
+		s:   s,
+		dec: json.NewDecoder(r),
+		w:   bufio.NewWriter(w),
+	}
+	if err := st.run(); err != nil {
+		return err
+	}
+	return st.w.Flush()
+}
+
+// frame is an object or array that is currently being compacted.
+type frame struct {
+	object  bool
+	key     string // raw key of the value being read, for objects
+	haveKey bool   // key has been read, the value comes next
+	index   int    // index of the value being read, for arrays
+	opened  bool   // the opening delimiter has been written
+	n       int    // number of children written
+}
+
+type streamer struct {
+	s     *StoreListener
+	dec   *json.Decoder
+	w     *bufio.Writer
+	stack []*frame
+}
+
+func (st *streamer) top() *frame {
+	if len(st.stack) == 0 {
+		return nil
+	}
+	return st.stack[len(st.stack)-1]
+}
+
+func (st *streamer) run() error {
+	for {
+		tok, err := st.dec.Token()
+		if errors.Is(err, io.EOF) {
+			if len(st.stack) != 0 {
+				return io.ErrUnexpectedEOF
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if top := st.top(); top != nil && top.object && !top.haveKey {
+			if key, ok := tok.(string); ok {
+				top.key, top.haveKey = key, true
+				continue
+			}
+		}
+
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			st.stack = append(st.stack, &frame{object: tok == json.Delim('{')})
+			continue
+		case json.Delim('}'), json.Delim(']'):
+			err = st.close()
+		default:
+			err = st.value(tok)
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(st.stack) == 0 {
+			if err := st.w.WriteByte('\n'); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// path returns the path of the value currently being read.
+func (st *streamer) path() string {
+	path := ""
+	for _, f := range st.stack {
+		if f.object {
+			path = joinPath(path, f.key)
+		} else {
+			path = indexPath(path, f.index)
+		}
+	}
+	return path
+}
+
+// next moves the top frame past the value that was just read.
+func (st *streamer) next() {
+	if top := st.top(); top != nil {
+		top.haveKey = false
+		top.index++
+	}
+}
+
+// value compacts and writes a scalar. Empty values in objects are left out,
+// like Store does.
+func (st *streamer) value(tok json.Token) error {
+	defer st.next()
+
+	// DontHash applies to values directly under a listed key, like in Store
+	dontHash := false
+	if top := st.top(); top != nil && top.object {
+		dontHash = slices.Contains(st.s.DontHash, top.key)
+	}
+	var val any = tok
+	switch v := tok.(type) {
+	case string:
+		val = st.s.compactString(v, dontHash, st.path())
+	case float64:
+		val = st.s.compactFloat(v, dontHash, st.path())
+	}
+	if top := st.top(); top != nil && top.object && isEmpty(val) {
+		return nil
+	}
+
+	b, err := json.Marshal(val)
+	if err != nil {
+		return err
+	}
+	if err := st.begin(len(st.stack)); err != nil {
+		return err
+	}
+	_, err = st.w.Write(b)
+	return err
+}
+
+// close finishes the top frame. Empty containers in objects are left out,
+// in arrays and at the top level they are kept.
+func (st *streamer) close() error {
+	f := st.top()
+	st.stack = st.stack[:len(st.stack)-1]
+	defer st.next()
+
+	if !f.opened {
+		if top := st.top(); top != nil && top.object {
+			return nil
+		}
+		if err := st.begin(len(st.stack)); err != nil {
+			return err
+		}
+		return st.delims(f)
+	}
+	return st.w.WriteByte(st.delim(f, false))
+}
+
+func (st *streamer) delim(f *frame, open bool) byte {
+	switch {
+	case f.object && open:
+		return '{'
+	case f.object:
+		return '}'
+	case open:
+		return '['
+	}
+	return ']'
+}
+
+func (st *streamer) delims(f *frame) error {
+	if err := st.w.WriteByte(st.delim(f, true)); err != nil {
+		return err
+	}
+	return st.w.WriteByte(st.delim(f, false))
+}
+
+// begin prepares writing a child into the frame at depth-1 (or the top
+// level for depth 0): it opens all pending containers and writes the
+// separator and key.
+func (st *streamer) begin(depth int) error {
+	if depth == 0 {
+		return nil
+	}
+	f := st.stack[depth-1]
+	if !f.opened {
+		if err := st.begin(depth - 1); err != nil {
+			return err
+		}
+		if err := st.w.WriteByte(st.delim(f, true)); err != nil {
+			return err
+		}
+		f.opened = true
+	}
+
+	if f.n > 0 {
+		if err := st.w.WriteByte(','); err != nil {
+			return err
+		}
+	}
+	f.n++
+	if f.object {
+		b, err := json.Marshal(st.s.saveKey(f.key))
+		if err != nil {
+			return err
+		}
+		if _, err := st.w.Write(b); err != nil {
+			return err
+		}
+		return st.w.WriteByte(':')
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package fstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompactJSON(t *testing.T) {
+	var data map[string]any
+	if err := json.Unmarshal(fp2, &data); err != nil {
+		t.Fatal(err)
+	}
+
+	stored := Listener()
+	stored.Threshhold = 5
+	stored.UseKeyCompression = true
+	res, err := stored.Store(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := stored.Restore(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := Listener()
+	f.Threshhold = 5
+	f.UseKeyCompression = true
+	var out bytes.Buffer
+	if err := f.CompactJSON(bytes.NewReader(fp2), &out); err != nil {
+		t.Fatal(err)
+	}
+
+	var streamed any
+	if err := json.Unmarshal(out.Bytes(), &streamed); err != nil {
+		t.Fatalf("invalid output: %v\n%s", err, out.String())
+	}
+	got, err := f.Restore(streamed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("streamed result differs from Store:\n%v\n%v", got, want)
+	}
+}
+
+func TestCompactJSONEmpty(t *testing.T) {
+	f := Listener()
+	f.Threshhold = 5
+	in := `{"a":"","b":{"c":[]},"d":[{},[],""],"e":false,"f":null,"g":1.5}` + "\n" + `[]`
+	var out bytes.Buffer
+	if err := f.CompactJSON(bytes.NewBufferString(in), &out); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"d":[{},[],""],"f":null,"g":1.5}` + "\n" + `[]` + "\n"
+	if out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
+
+func TestCompactJSONDontHash(t *testing.T) {
+	in := `{"ua":"Mozilla/5.0","id":"abc","n":8,"w":1.5,"tls":{"id":"xyz","h":"h_0"},"list":["abc",2]}`
+	listener := func() *StoreListener {
+		f := Listener()
+		f.Threshhold = 5
+		f.DontHash = []string{"id", "n"}
+		return f
+	}
+
+	stored := listener()
+	data, err := DecodeJSON([]byte(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := stored.Store(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := json.Marshal(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := listener()
+	var out bytes.Buffer
+	if err := f.CompactJSON(bytes.NewBufferString(in), &out); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSuffix(out.String(), "\n"); got != string(want) {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	values := func(f *StoreListener) map[string]string {
+		m := map[string]string{}
+		for _, e := range f.Database().Entries(ValueEntry) {
+			m[e.ID] = e.Value
+		}
+		return m
+	}
+	if got, want := values(f), values(stored); !reflect.DeepEqual(got, want) {
+		t.Errorf("got values %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,256 @@
+package fstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/exp/slices"
+)
+
+// Version is a state of a Database. Entries are only ever appended, with
+// ids counting up per kind, so the number of entries of each kind is enough
+// to tell which entries a copy of the dictionary is missing.
+type Version struct {
+	Values int
+	Keys   int
+	Shapes int
+}
+
+// Version returns the current version of the dictionary.
+func (d *Database) Version() Version {
+	return Version{Values: len(d.hashValues), Keys: len(d.hashKeys), Shapes: len(d.shapes)}
+}
+
+// Covers reports whether a dictionary at version v has all entries of a
+// dictionary at version o.
+func (v Version) Covers(o Version) bool {
+	return v.Values >= o.Values && v.Keys >= o.Keys && v.Shapes >= o.Shapes
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Values, v.Keys, v.Shapes)
+}
+
+// Since returns the entries added after version v, values first, then keys
+// and shapes, each in the order they were added.
+func (d *Database) Since(v Version) []Entry {
+	var entries []Entry
+	entries = d.since(ValueEntry, "h_", v.Values, len(d.valueList), entries)
+	entries = d.since(KeyEntry, "h_", v.Keys, len(d.keyList), entries)
+	return d.since(ShapeEntry, "s_", v.Shapes, len(d.shapeList), entries)
+}
+
+// since appends the entries of a kind from sequence number from up to n.
+// Ids count up from 0, so they are the positions in the entry lists.
+func (d *Database) since(kind EntryKind, prefix string, from, n int, entries []Entry) []Entry {
+	for i := max(from, 0); i < n; i++ {
+		e, _ := d.Entry(kind, prefix+strconv.Itoa(i))
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// Apply adds entries returned by Since of another dictionary. Entries the
+// dictionary already has are skipped, the others have to continue its ids.
+func (d *Database) Apply(entries []Entry) error {
+	for _, e := range entries {
+		n, prefix := len(d.hashValues), "h"
+		switch e.Kind {
+		case KeyEntry:
+			n = len(d.hashKeys)
+		case ShapeEntry:
+			n, prefix = len(d.shapes), "s"
+		}
+		if _, ok := d.Entry(e.Kind, e.ID); ok {
+			continue
+		}
+		if want := fmt.Sprintf("%s_%d", prefix, n); e.ID != want {
+			return fmt.Errorf("got %s %s, want %s", e.Kind, e.ID, want)
+		}
+		d.add(e.Kind, e.ID, e.Value, slices.Clone(e.Keys))
+	}
+	return nil
+}
+
+// Fetcher returns the entries a remote dictionary added since a version,
+// see Database.Since.
+type Fetcher func(since Version) ([]Entry, error)
+
+// ReplicaOptions configures NewReplica.
+type ReplicaOptions struct {
+	// UseKeyCompression has to match the listener the records were
+	// compacted with.
+	UseKeyCompression bool
+}
+
+// Replica is a client-side copy of a remote dictionary. It restores
+// compacted records locally and fetches only the entries it is missing.
+// It is safe for concurrent use.
+type Replica struct {
+	mu    sync.Mutex
+	fetch Fetcher
+	s     *StoreListener
+}
+
+func NewReplica(fetch Fetcher, opts ReplicaOptions) *Replica {
+	s := Listener()
+	s.UseKeyCompression = opts.UseKeyCompression
+	return &Replica{fetch: fetch, s: s}
+}
+
+// Database returns the local copy of the dictionary. It must not be used
+// while the replica syncs.
+func (r *Replica) Database() *Database {
+	return &r.s.database
+}
+
+// Version returns the version of the local copy of the dictionary.
+func (r *Replica) Version() Version {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.s.database.Version()
+}
+
+// Sync fetches the entries added since the local version.
+func (r *Replica) Sync() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.sync()
+}
+
+func (r *Replica) sync() error {
+	entries, err := r.fetch(r.s.database.Version())
+	if err != nil {
+		return fmt.Errorf("could not sync dictionary: %w", err)
+	}
+	return r.s.database.Apply(entries)
+}
+
+// Restore restores compacted data, syncing first if it references
+// entries the local dictionary does not have. Deltas cannot be restored,
+// their base records are not known to the replica.
+func (r *Replica) Restore(data any) (any, error) {
+	need, err := r.requires(data)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.s.database.Version().Covers(need) {
+		if err := r.sync(); err != nil {
+			return nil, err
+		}
+	}
+	return r.s.Restore(data)
+}
+
+// requires returns the lowest version of the dictionary that has all
+// entries referenced by data. For versioned records that is the version in
+// their header, otherwise all value ids in data count, literals are
+// escaped so they never look like one.
+func (r *Replica) requires(data any) (Version, error) {
+	if vr, ok := asVersioned(data); ok {
+		return vr.Version, nil
+	}
+	var v Version
+	// seq returns the number of entries up to id, which has to be well
+	// formed
+	seq := func(id, prefix string) (int, error) {
+		n, ok := strings.CutPrefix(id, prefix)
+		i, err := strconv.Atoi(n)
+		if !ok || err != nil || i < 0 {
+			return 0, fmt.Errorf("invalid id %q", id)
+		}
+		return i + 1, nil
+	}
+	var walk func(data any) error
+	walk = func(data any) error {
+		if sh, ok := asShaped(data); ok {
+			n, err := seq(sh.Shape, "s_")
+			if err != nil {
+				return err
+			}
+			v.Shapes = max(v.Shapes, n)
+			for _, e := range sh.Values {
+				if err := walk(e); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if _, ok := asDelta(data); ok {
+			return errors.New("a replica cannot restore deltas")
+		}
+		if keys, fields, ok := objectFields(data); ok {
+			for _, k := range keys {
+				if r.s.UseKeyCompression && IsRef(k) {
+					n, err := seq(k, "h_")
+					if err != nil {
+						return err
+					}
+					v.Keys = max(v.Keys, n)
+				}
+				if err := walk(fields[k]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if arr, ok := data.([]any); ok {
+			for _, e := range arr {
+				if err := walk(e); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if str, ok := data.(string); ok && IsRef(str) {
+			n, err := seq(str, "h_")
+			if err != nil {
+				return err
+			}
+			v.Values = max(v.Values, n)
+		}
+		return nil
+	}
+	return v, walk(data)
+}
+
+// syncResponse is the response of GET /dict.
+type syncResponse struct {
+	Version Version `json:"version"`
+	Entries []Entry `json:"entries"`
+}
+
+// HTTPFetcher fetches entries from a Handler at baseURL, like
+// "http://localhost:8080". A nil client uses http.DefaultClient.
+func HTTPFetcher(baseURL string, client *http.Client) Fetcher {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return func(since Version) ([]Entry, error) {
+		q := url.Values{}
+		q.Set("values", strconv.Itoa(since.Values))
+		q.Set("keys", strconv.Itoa(since.Keys))
+		q.Set("shapes", strconv.Itoa(since.Shapes))
+		resp, err := client.Get(baseURL + "/dict?" + q.Encode())
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		var res syncResponse
+		if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+			return nil, err
+		}
+		return res.Entries, nil
+	}
+}
@@ -0,0 +1,158 @@
+package fstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestReplica(t *testing.T) {
+	f := Listener()
+	f.Threshhold = 5
+	f.UseKeyCompression = true
+	f.UseShapes = true
+	srv := httptest.NewServer(NewHandler(f))
+	defer srv.Close()
+
+	fetches := 0
+	fetch := HTTPFetcher(srv.URL, nil)
+	r := NewReplica(func(since Version) ([]Entry, error) {
+		fetches++
+		return fetch(since)
+	}, ReplicaOptions{UseKeyCompression: true})
+
+	check := func(data map[string]any) {
+		t.Helper()
+		id, err := f.Put(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec, _ := f.Compacted(id)
+		got, err := r.Restore(rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _ := f.Get(id)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+
+	check(map[string]any{"user_agent": "Mozilla/5.0 A", "fonts": []any{"Arial"}})
+	check(map[string]any{"user_agent": "Mozilla/5.0 A", "fonts": []any{"Arial"}})
+	if fetches != 1 {
+		t.Errorf("expected a single fetch, got %d", fetches)
+	}
+	check(map[string]any{"user_agent": "Mozilla/5.0 B", "fonts": []any{"Arial", "Helvetica"}, "cores": 8.0})
+	if fetches != 2 || r.Database().Version() != f.Database().Version() {
+		t.Errorf("expected a second fetch up to %v, got %d fetches and %v", f.Database().Version(), fetches, r.Database().Version())
+	}
+
+	// versioned records tell the replica exactly when to sync
+	v, err := f.StoreVersioned(map[string]any{"platform": "Linux"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := r.Restore(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := json.Marshal(got); fetches != 3 || string(b) != `{"platform":"Linux"}` {
+		t.Errorf("got %s after %d fetches", b, fetches)
+	}
+}
+
+func TestApply(t *testing.T) {
+	d := GetDatabase()
+	d.SaveHash("a")
+	d.SaveHash("b")
+	d.SaveKey("k")
+
+	c := GetDatabase()
+	if err := c.Apply(d.Since(Version{})); err != nil {
+		t.Fatal(err)
+	}
+	d.SaveHash("c")
+	if err := c.Apply(d.Since(Version{Values: 1})); err != nil {
+		t.Fatal(err)
+	}
+	if c.Version() != d.Version() {
+		t.Errorf("got version %v, want %v", c.Version(), d.Version())
+	}
+
+	d.SaveHash("d")
+	d.SaveHash("e")
+	if got := d.Since(Version{Values: 3, Keys: 1}); len(got) != 2 || got[0].ID != "h_3" || got[1].Value != "e" {
+		t.Errorf("unexpected entries since 3.1.0: %v", got)
+	}
+	if err := c.Apply(d.Since(Version{Values: 4})); err == nil {
+		t.Error("expected an error for a gap in the ids")
+	}
+}
+
+func TestReplicaConcurrent(t *testing.T) {
+	f := Listener()
+	f.Threshhold = 5
+	f.UseKeyCompression = true
+	var recs []any
+	for i := 0; i < 20; i++ {
+		id, err := f.Put(map[string]any{"user_agent": fmt.Sprintf("Mozilla/5.0 %d", i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec, _ := f.Compacted(id)
+		recs = append(recs, rec)
+	}
+
+	var mu sync.Mutex
+	fetches := 0
+	r := NewReplica(func(since Version) ([]Entry, error) {
+		mu.Lock()
+		fetches++
+		mu.Unlock()
+		return f.Database().Since(since), nil
+	}, ReplicaOptions{UseKeyCompression: true})
+
+	var wg sync.WaitGroup
+	for i, rec := range recs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := r.Restore(rec)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if b, _ := json.Marshal(got); string(b) != fmt.Sprintf(`{"user_agent":"Mozilla/5.0 %d"}`, i) {
+				t.Errorf("got %s for record %d", b, i)
+			}
+		}()
+	}
+	wg.Wait()
+	if r.Version() != f.Database().Version() || fetches > len(recs) {
+		t.Errorf("got version %v after %d fetches", r.Version(), fetches)
+	}
+
+	// escaped literals are no references
+	fetches = 0
+	got, err := r.Restore(map[string]any{"h_0": "~h_999"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := json.Marshal(got); fetches != 0 || string(b) != `{"user_agent":"h_999"}` {
+		t.Errorf("got %s after %d fetches", b, fetches)
+	}
+
+	for _, data := range []any{
+		map[string]any{"$s": "", "$v": []any{}},
+		map[string]any{"$s": "s_x", "$v": []any{}},
+		"h_99999999999999999999",
+	} {
+		if _, err := r.Restore(data); err == nil {
+			t.Errorf("expected an error for %v", data)
+		}
+	}
+}
@@ -18,6 +18,10 @@ func isEmpty(s any) bool {
 		return v == 0
 	case int64:
 		return v == 0
+	case *Object:
+		return v.Len() == 0
+	case *Shaped:
+		return len(v.Values) == 0
 	default:
 		rt := reflect.ValueOf(v)
 		if reflect.Array == rt.Kind() || reflect.Slice == rt.Kind() || reflect.Map == rt.Kind() {
@@ -31,3 +35,15 @@ func isEmpty(s any) bool {
 	}
 
 }
+
+// isScalar reports whether values of kind k can be stored as they are.
+func isScalar(k reflect.Kind) bool {
+	switch k {
+	case reflect.Bool,
+		reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32:
+		return true
+	}
+	return false
+}